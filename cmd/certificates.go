@@ -1,24 +1,50 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
 
 	"github.com/MakeNowJust/heredoc"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"k8s.io/client-go/kubernetes"
 
 	"github.com/mikelorant/muting/pkg/certificates"
 	"github.com/mikelorant/muting/pkg/mutationconfig"
+	"github.com/mikelorant/muting/pkg/mutator"
 )
 
 type CertificatesConfig struct {
-	Name      string `mapstructure:"name"`
-	Namespace string `mapstructure:"namespace"`
-	Service   string `mapstructure:"service"`
-	Output    string `mapstructure:"output"`
+	Name        string   `mapstructure:"name"`
+	Namespace   string   `mapstructure:"namespace"`
+	Service     string   `mapstructure:"service"`
+	Output      string   `mapstructure:"output"`
+	Istio       bool     `mapstructure:"istio"`
+	GatewayAPI  bool     `mapstructure:"gateway_api"`
+	OpenShift   bool     `mapstructure:"openshift"`
+	Traefik     bool     `mapstructure:"traefik"`
+	Validate    bool     `mapstructure:"validate"`
+	Allowed     []string `mapstructure:"allowed_domain"`
+	Secret      string   `mapstructure:"secret"`
+	CertManager bool     `mapstructure:"cert_manager"`
+
+	KeyAlgorithm string        `mapstructure:"key_algorithm"`
+	Validity     time.Duration `mapstructure:"validity"`
+	CAValidity   time.Duration `mapstructure:"ca_validity"`
+	CACert       string        `mapstructure:"ca_cert"`
+	CAKey        string        `mapstructure:"ca_key"`
+
+	ReviewVersions []string `mapstructure:"review_versions"`
 }
 
+// caRenewBefore is how long a CA stored in a secret must remain valid to be
+// reused
+const caRenewBefore = 30 * 24 * time.Hour
+
 var (
 	certificatesCmd = &cobra.Command{
 		Use:   "certificates",
@@ -38,6 +64,20 @@ func init() {
 	certificatesCmd.Flags().StringP("namespace", "", "default", "Webhook namespace")
 	certificatesCmd.Flags().StringP("service", "s", "muting", "Webhook service")
 	certificatesCmd.Flags().StringP("output", "o", "/tmp/tls", "Output directory")
+	certificatesCmd.Flags().BoolP("istio", "", false, "Mutate Istio virtual services and gateways")
+	certificatesCmd.Flags().BoolP("gateway-api", "", false, "Mutate Gateway API routes and gateways")
+	certificatesCmd.Flags().BoolP("openshift", "", false, "Mutate OpenShift routes")
+	certificatesCmd.Flags().BoolP("traefik", "", false, "Mutate Traefik ingress routes")
+	certificatesCmd.Flags().BoolP("validate", "", false, "Apply a validating webhook configuration denying ingress hosts outside the allowed domains")
+	certificatesCmd.Flags().StringArrayP("allowed-domain", "d", nil, "Domain the server allows hosts in, required to validate (repeatable)")
+	certificatesCmd.Flags().StringP("secret", "", "", "Secret in the webhook namespace storing the certificates, reusing its CA while valid")
+	certificatesCmd.Flags().BoolP("cert-manager", "", false, "Create a cert-manager CA, CA issuer and certificate stored in the secret instead of self-signing")
+	certificatesCmd.Flags().StringP("key-algorithm", "", string(certificates.RSA4096), "Key algorithm (rsa2048, rsa3072, rsa4096, ecdsa-p256, ecdsa-p384 or ed25519)")
+	certificatesCmd.Flags().DurationP("validity", "", 365*24*time.Hour, "Server certificate validity period")
+	certificatesCmd.Flags().DurationP("ca-validity", "", 365*24*time.Hour, "CA certificate validity period")
+	certificatesCmd.Flags().StringP("ca-cert", "", "", "CA certificate file signing the server certificate, followed by its chain for an intermediate CA")
+	certificatesCmd.Flags().StringP("ca-key", "", "", "CA key file signing the server certificate")
+	certificatesCmd.Flags().StringSliceP("review-versions", "", []string{"v1"}, "AdmissionReview versions in order of preference")
 }
 
 func initCertificatesConfig() {
@@ -47,6 +87,20 @@ func initCertificatesConfig() {
 	viper.BindPFlag("namespace", certificatesCmd.Flags().Lookup("namespace"))
 	viper.BindPFlag("service", certificatesCmd.Flags().Lookup("service"))
 	viper.BindPFlag("output", certificatesCmd.Flags().Lookup("output"))
+	viper.BindPFlag("istio", certificatesCmd.Flags().Lookup("istio"))
+	viper.BindPFlag("gateway_api", certificatesCmd.Flags().Lookup("gateway-api"))
+	viper.BindPFlag("openshift", certificatesCmd.Flags().Lookup("openshift"))
+	viper.BindPFlag("traefik", certificatesCmd.Flags().Lookup("traefik"))
+	viper.BindPFlag("validate", certificatesCmd.Flags().Lookup("validate"))
+	viper.BindPFlag("allowed_domain", certificatesCmd.Flags().Lookup("allowed-domain"))
+	viper.BindPFlag("secret", certificatesCmd.Flags().Lookup("secret"))
+	viper.BindPFlag("cert_manager", certificatesCmd.Flags().Lookup("cert-manager"))
+	viper.BindPFlag("key_algorithm", certificatesCmd.Flags().Lookup("key-algorithm"))
+	viper.BindPFlag("validity", certificatesCmd.Flags().Lookup("validity"))
+	viper.BindPFlag("ca_validity", certificatesCmd.Flags().Lookup("ca-validity"))
+	viper.BindPFlag("ca_cert", certificatesCmd.Flags().Lookup("ca-cert"))
+	viper.BindPFlag("ca_key", certificatesCmd.Flags().Lookup("ca-key"))
+	viper.BindPFlag("review_versions", certificatesCmd.Flags().Lookup("review-versions"))
 
 	if err := viper.Unmarshal(&certificatesConfig); err != nil {
 		log.Fatal(err)
@@ -57,11 +111,7 @@ func initCertificatesConfig() {
 
 func doCertificates() {
 	commonName := certificatesConfig.Service + "." + certificatesConfig.Namespace + ".svc"
-	dnsNames := []string{
-		certificatesConfig.Service,
-		certificatesConfig.Service + "." + certificatesConfig.Namespace,
-		certificatesConfig.Service + "." + certificatesConfig.Namespace + ".svc",
-	}
+	dnsNames := serviceDNSNames(certificatesConfig.Service, certificatesConfig.Namespace)
 
 	// Used for local debugging.
 	// commonName := "host.minikube.internal"
@@ -72,27 +122,217 @@ func doCertificates() {
 	// 	certificatesConfig.Service+"."+certificatesConfig.Namespace+".svc",
 	// }
 
-	log.Info("Generating certificate authority.")
-	caConfig, _ := certificates.NewCACertificate()
+	for _, version := range certificatesConfig.ReviewVersions {
+		if !supportedReviewVersion(version) {
+			log.Fatalf("Unsupported AdmissionReview version: %s", version)
+		}
+	}
 
-	log.Info("Generating server certificates.")
-	serverConfig, _ := certificates.NewServerCertificate(&caConfig, commonName, dnsNames)
+	keyAlgorithm, err := certificates.ParseKeyAlgorithm(certificatesConfig.KeyAlgorithm)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	log.Info(fmt.Sprintf("Writing certificates to: %s", certificatesConfig.Output))
-	if err := certificates.WriteCertificates(certificatesConfig.Output, &caConfig, &serverConfig); err != nil {
-		log.Panic(err)
+	// the server only serves validation when domains are allowed, so the
+	// webhook would fail every request without them
+	if certificatesConfig.Validate && len(certificatesConfig.Allowed) == 0 {
+		log.Fatal("Allowed domains are required to validate.")
+	}
+
+	if certificatesConfig.CertManager && certificatesConfig.Secret == "" {
+		log.Fatal("A secret is required for cert-manager certificates.")
+	}
+
+	if (certificatesConfig.CACert == "") != (certificatesConfig.CAKey == "") {
+		log.Fatal("A CA certificate and key are required together.")
+	}
+
+	if certificatesConfig.CertManager && certificatesConfig.CACert != "" {
+		log.Fatal("A CA certificate cannot be used with cert-manager certificates.")
+	}
+
+	// the key of a CA loaded from files is not copied into the secret
+	if certificatesConfig.Secret != "" && certificatesConfig.CACert != "" {
+		log.Fatal("A CA certificate cannot be used with a secret.")
 	}
 
 	log.Info("Creating Kubernetes client.")
 	client := mutationconfig.CreateClient()
 
+	var caCert *bytes.Buffer
+	var injectCAFrom string
+	if certificatesConfig.CertManager {
+		injectCAFrom = applyCertManagerCertificate(commonName, dnsNames, keyAlgorithm)
+	} else {
+		caCert = writeCertificates(client, commonName, dnsNames, keyAlgorithm)
+	}
+
+	resources := mutationconfig.IngressResources
+	if certificatesConfig.Istio {
+		resources = append(resources, mutationconfig.IstioResources...)
+	}
+	if certificatesConfig.GatewayAPI {
+		resources = append(resources, mutationconfig.GatewayAPIResources...)
+	}
+	if certificatesConfig.OpenShift {
+		resources = append(resources, mutationconfig.OpenShiftResources...)
+	}
+	if certificatesConfig.Traefik {
+		resources = append(resources, mutationconfig.TraefikResources...)
+	}
+
 	log.Info("Generating mutating webhook configuration.")
-	mutateConfig := mutationconfig.GenerateMutationConfig(certificatesConfig.Name, certificatesConfig.Namespace, certificatesConfig.Service, caConfig.GetCertificatePEM())
+	mutateConfig := mutationconfig.GenerateMutationConfig(certificatesConfig.Name, certificatesConfig.Namespace, certificatesConfig.Service, caCert, injectCAFrom, resources, certificatesConfig.ReviewVersions)
 
 	log.Info("Applying mutating webhook configuration.")
 	if err := mutationconfig.ApplyMutationConfig(client, certificatesConfig.Name, mutateConfig); err != nil {
 		log.Panic(err)
 	}
+
+	if certificatesConfig.Validate {
+		log.Info("Generating validating webhook configuration.")
+		// only ingresses are validated, as the hosts of other resources need
+		// not be domain names, such as Istio mesh hosts
+		validateConfig := mutationconfig.GenerateValidationConfig(certificatesConfig.Name, certificatesConfig.Namespace, certificatesConfig.Service, caCert, injectCAFrom, mutationconfig.IngressResources, certificatesConfig.ReviewVersions)
+
+		log.Info("Applying validating webhook configuration.")
+		if err := mutationconfig.ApplyValidationConfig(client, certificatesConfig.Name, validateConfig); err != nil {
+			log.Panic(err)
+		}
+	}
+}
+
+// writeCertificates self-signs the server certificates, writing them to the
+// output directory and the secret, and returns the CA certificate
+func writeCertificates(client kubernetes.Interface, commonName string, dnsNames []string, keyAlgorithm certificates.KeyAlgorithm) *bytes.Buffer {
+	caConfig, err := certificateAuthority(client, keyAlgorithm)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	log.Info("Generating server certificates.")
+	serverConfig, err := certificates.NewServerCertificate(&caConfig, commonName, dnsNames, keyAlgorithm, certificatesConfig.Validity)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	log.Info(fmt.Sprintf("Writing certificates to: %s", certificatesConfig.Output))
+	if err := certificates.WriteCertificates(certificatesConfig.Output, &caConfig, &serverConfig); err != nil {
+		log.Panic(err)
+	}
+
+	if certificatesConfig.Secret != "" {
+		log.Info(fmt.Sprintf("Writing certificates to secret: %s/%s", certificatesConfig.Namespace, certificatesConfig.Secret))
+		if err := certificates.WriteSecret(client, certificatesConfig.Namespace, certificatesConfig.Secret, &caConfig, &serverConfig); err != nil {
+			log.Panic(err)
+		}
+	}
+
+	return caConfig.GetCertificatePEM()
+}
+
+// applyCertManagerCertificate creates a cert-manager CA signed by a
+// self-signed issuer, a CA issuer signing with it and a certificate issued
+// by the CA issuer to the secret, and returns the inject-ca-from annotation
+// value of the certificate
+func applyCertManagerCertificate(commonName string, dnsNames []string, keyAlgorithm certificates.KeyAlgorithm) string {
+	log.Info("Creating Kubernetes dynamic client.")
+	dynamicClient := mutationconfig.CreateDynamicClient()
+
+	selfSignedName := certificatesConfig.Name + "-selfsigned"
+	caName := certificatesConfig.Name + "-ca"
+
+	log.Info("Applying cert-manager self-signed issuer.")
+	selfSigned := mutationconfig.GenerateIssuer(selfSignedName, certificatesConfig.Namespace, "")
+	if err := mutationconfig.ApplyUnstructured(dynamicClient, mutationconfig.IssuerResource, selfSigned); err != nil {
+		log.Panic(err)
+	}
+
+	log.Info("Applying cert-manager CA certificate.")
+	caCertificate := mutationconfig.GenerateCACertificate(caName, certificatesConfig.Namespace, caName, selfSignedName, keyAlgorithm, certificatesConfig.CAValidity)
+	if err := mutationconfig.ApplyUnstructured(dynamicClient, mutationconfig.CertificateResource, caCertificate); err != nil {
+		log.Panic(err)
+	}
+
+	log.Info("Applying cert-manager CA issuer.")
+	issuer := mutationconfig.GenerateIssuer(certificatesConfig.Name, certificatesConfig.Namespace, caName)
+	if err := mutationconfig.ApplyUnstructured(dynamicClient, mutationconfig.IssuerResource, issuer); err != nil {
+		log.Panic(err)
+	}
+
+	log.Info("Applying cert-manager certificate.")
+	certificate := mutationconfig.GenerateCertificate(certificatesConfig.Name, certificatesConfig.Namespace, certificatesConfig.Secret, certificatesConfig.Name, commonName, dnsNames, keyAlgorithm, certificatesConfig.Validity)
+	if err := mutationconfig.ApplyUnstructured(dynamicClient, mutationconfig.CertificateResource, certificate); err != nil {
+		log.Panic(err)
+	}
+
+	return mutationconfig.InjectCAFrom(certificatesConfig.Namespace, certificatesConfig.Name)
+}
+
+// certificateAuthority returns the CA loaded from the CA files, or the CA
+// stored in the secret while it remains valid, otherwise a new CA
+func certificateAuthority(client kubernetes.Interface, keyAlgorithm certificates.KeyAlgorithm) (certificates.CAConfig, error) {
+	if certificatesConfig.CACert != "" {
+		log.Info(fmt.Sprintf("Loading certificate authority from: %s", certificatesConfig.CACert))
+		caConfig, err := loadCertificateAuthority(certificatesConfig.CACert, certificatesConfig.CAKey)
+		// the key is kept where it was loaded from rather than written out
+		caConfig.ExcludeKey()
+		return caConfig, err
+	}
+
+	if certificatesConfig.Secret != "" {
+		caConfig, ok, err := certificates.ReadSecretCA(client, certificatesConfig.Namespace, certificatesConfig.Secret)
+		if err != nil {
+			return caConfig, err
+		}
+		if ok && caConfig.ValidFor(caRenewBefore) {
+			log.Info("Reusing certificate authority from secret.")
+			return caConfig, nil
+		}
+	}
+
+	log.Info("Generating certificate authority.")
+	return certificates.NewCACertificate(keyAlgorithm, certificatesConfig.CAValidity)
+}
+
+func loadCertificateAuthority(certFile string, keyFile string) (caConfig certificates.CAConfig, err error) {
+	certPEM, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return caConfig, fmt.Errorf("unable to read CA certificate: %w", err)
+	}
+
+	keyPEM, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return caConfig, fmt.Errorf("unable to read CA key: %w", err)
+	}
+
+	if caConfig, err = certificates.LoadCA(certPEM, keyPEM); err != nil {
+		return caConfig, err
+	}
+
+	if !caConfig.ValidFor(0) {
+		return caConfig, fmt.Errorf("CA certificate %s is not valid", certFile)
+	}
+
+	return caConfig, nil
+}
+
+// serviceDNSNames returns the DNS names of the webhook service
+func serviceDNSNames(service string, namespace string) []string {
+	return []string{
+		service,
+		service + "." + namespace,
+		service + "." + namespace + ".svc",
+	}
+}
+
+func supportedReviewVersion(version string) bool {
+	for _, supported := range mutator.SupportedReviewVersions {
+		if version == supported {
+			return true
+		}
+	}
+	return false
 }
 
 func (c CertificatesConfig) String() string {
@@ -101,6 +341,20 @@ func (c CertificatesConfig) String() string {
 			Namespace: %s
 			Service: %s
 			Output: %s
+			Istio: %t
+			Gateway API: %t
+			OpenShift: %t
+			Traefik: %t
+			Validate: %t
+			Allowed Domains: %s
+			Secret: %s
+			Cert Manager: %t
+			Key Algorithm: %s
+			Validity: %s
+			CA Validity: %s
+			CA Certificate: %s
+			CA Key: %s
+			Review Versions: %s
 		`)
-	return fmt.Sprintf(formatting, c.Name, c.Namespace, c.Service, c.Output)
+	return fmt.Sprintf(formatting, c.Name, c.Namespace, c.Service, c.Output, c.Istio, c.GatewayAPI, c.OpenShift, c.Traefik, c.Validate, strings.Join(c.Allowed, ", "), c.Secret, c.CertManager, c.KeyAlgorithm, c.Validity, c.CAValidity, c.CACert, c.CAKey, strings.Join(c.ReviewVersions, ", "))
 }
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/mikelorant/muting/pkg/certificates"
+)
+
+func TestCertificateAuthority(t *testing.T) {
+	defer func(config CertificatesConfig) { certificatesConfig = config }(certificatesConfig)
+	certificatesConfig = CertificatesConfig{
+		Namespace:  "default",
+		Secret:     "muting-tls",
+		CAValidity: 365 * 24 * time.Hour,
+	}
+
+	tc := []struct {
+		name     string
+		validity time.Duration
+		reused   bool
+	}{
+		{
+			name:     "valid CA",
+			validity: 365 * 24 * time.Hour,
+			reused:   true,
+		},
+		{
+			name:     "expiring CA",
+			validity: caRenewBefore,
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			stored := writeTestSecret(t, client, test.validity)
+
+			caConfig, err := certificateAuthority(client, certificates.ECDSAP256)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, test.reused, string(stored) == caConfig.GetCertificatePEM().String())
+			assert.True(t, caConfig.ValidFor(caRenewBefore))
+		})
+	}
+}
+
+func TestCertificateAuthorityWithoutSecret(t *testing.T) {
+	defer func(config CertificatesConfig) { certificatesConfig = config }(certificatesConfig)
+	certificatesConfig = CertificatesConfig{
+		Namespace:  "default",
+		Secret:     "muting-tls",
+		CAValidity: time.Hour,
+	}
+
+	caConfig, err := certificateAuthority(fake.NewSimpleClientset(), certificates.ECDSAP256)
+	assert.NoError(t, err)
+	assert.True(t, caConfig.ValidFor(0))
+}
+
+// writeTestSecret writes certificates signed by a CA valid for the validity
+// period to the secret, and returns the CA certificate
+func writeTestSecret(t *testing.T, client *fake.Clientset, validity time.Duration) []byte {
+	t.Helper()
+
+	caConfig, err := certificates.NewCACertificate(certificates.ECDSAP256, validity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig, err := certificates.NewServerCertificate(&caConfig, "muting.default.svc", []string{"muting.default.svc"}, certificates.ECDSAP256, validity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := certificates.WriteSecret(client, "default", "muting-tls", &caConfig, &serverConfig); err != nil {
+		t.Fatal(err)
+	}
+	return caConfig.GetCertificatePEM().Bytes()
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/MakeNowJust/heredoc"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/mikelorant/muting/pkg/certificates"
+	"github.com/mikelorant/muting/pkg/mutationconfig"
+)
+
+type InspectConfig struct {
+	Name      string `mapstructure:"name"`
+	Namespace string `mapstructure:"namespace"`
+	Service   string `mapstructure:"service"`
+	Dir       string `mapstructure:"dir"`
+	Webhook   bool   `mapstructure:"webhook"`
+	Days      int    `mapstructure:"days"`
+}
+
+var (
+	inspectCmd = &cobra.Command{
+		Use:   "inspect",
+		Short: "Check webhook certificates",
+		Long: heredoc.Doc(`
+			Check that the webhook server certificate chains to the CA, is valid
+			for the webhook service and matches its key, exiting non-zero when a
+			check fails or the certificate expires within the threshold.
+		`),
+		Run: func(cmd *cobra.Command, args []string) {
+			doInspect()
+		},
+	}
+
+	inspectConfig InspectConfig
+)
+
+func init() {
+	cobra.OnInitialize(initInspectConfig)
+	certificatesCmd.AddCommand(inspectCmd)
+	inspectCmd.Flags().StringP("name", "n", "muting", "Mutation configuration name")
+	inspectCmd.Flags().StringP("namespace", "", "default", "Webhook namespace")
+	inspectCmd.Flags().StringP("service", "s", "muting", "Webhook service")
+	inspectCmd.Flags().StringP("dir", "d", "/tmp/tls", "Certificates directory")
+	inspectCmd.Flags().BoolP("webhook", "", false, "Check against the CA bundles of the webhook configurations instead of ca.crt")
+	inspectCmd.Flags().IntP("days", "", 30, "Fail when the certificate expires within this many days")
+}
+
+func initInspectConfig() {
+	viper.SetEnvPrefix("inspect")
+	viper.AutomaticEnv()
+	viper.BindPFlag("name", inspectCmd.Flags().Lookup("name"))
+	viper.BindPFlag("namespace", inspectCmd.Flags().Lookup("namespace"))
+	viper.BindPFlag("service", inspectCmd.Flags().Lookup("service"))
+	viper.BindPFlag("dir", inspectCmd.Flags().Lookup("dir"))
+	viper.BindPFlag("webhook", inspectCmd.Flags().Lookup("webhook"))
+	viper.BindPFlag("days", inspectCmd.Flags().Lookup("days"))
+
+	if err := viper.Unmarshal(&inspectConfig); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func doInspect() {
+	certPEM, err := ioutil.ReadFile(filepath.Join(inspectConfig.Dir, "tls.crt"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	keyPEM, err := ioutil.ReadFile(filepath.Join(inspectConfig.Dir, "tls.key"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var caBundles [][]byte
+	if inspectConfig.Webhook {
+		log.Info("Creating Kubernetes client.")
+		client := mutationconfig.CreateClient()
+
+		log.Info(fmt.Sprintf("Reading CA bundles of webhook configuration: %s", inspectConfig.Name))
+		if caBundles, err = mutationconfig.GetCABundles(client, inspectConfig.Name); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		caCert, err := ioutil.ReadFile(filepath.Join(inspectConfig.Dir, "ca.crt"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		caBundles = [][]byte{caCert}
+	}
+
+	dnsNames := serviceDNSNames(inspectConfig.Service, inspectConfig.Namespace)
+	if !inspectCertificates(caBundles, certPEM, keyPEM, dnsNames, inspectConfig.Days, time.Now()) {
+		os.Exit(1)
+	}
+}
+
+// inspectCertificates logs the inspection of the server certificate against
+// each CA bundle and reports whether all checks pass
+func inspectCertificates(caBundles [][]byte, certPEM []byte, keyPEM []byte, dnsNames []string, days int, now time.Time) bool {
+	healthy := len(caBundles) > 0
+	if !healthy {
+		log.Error("No CA bundles to check the certificate against.")
+	}
+
+	for _, caBundle := range caBundles {
+		inspection, err := certificates.Inspect(caBundle, certPEM, keyPEM, dnsNames, now)
+		if err != nil {
+			log.Error(err)
+			healthy = false
+			continue
+		}
+
+		daysLeft := inspection.DaysLeft(now)
+		log.Info(fmt.Sprintf("Certificate %s for %s expires on %s, in %d days.", inspection.CommonName, strings.Join(inspection.DNSNames, ", "), inspection.NotAfter.Format(time.RFC3339), daysLeft))
+
+		for _, problem := range inspection.Problems {
+			log.Error(fmt.Sprintf("Certificate check failed: %s", problem))
+			healthy = false
+		}
+
+		if daysLeft < days {
+			log.Error(fmt.Sprintf("Certificate expires within %d days.", days))
+			healthy = false
+		}
+	}
+
+	return healthy
+}
+
+func (c InspectConfig) String() string {
+	formatting := heredoc.Doc(`
+			Name: %s
+			Namespace: %s
+			Service: %s
+			Dir: %s
+			Webhook: %t
+			Days: %d
+		`)
+	return fmt.Sprintf(formatting, c.Name, c.Namespace, c.Service, c.Dir, c.Webhook, c.Days)
+}
@@ -1,26 +1,54 @@
 package cmd
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/MakeNowJust/heredoc"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
 
+	"github.com/mikelorant/muting/pkg/certificates"
+	"github.com/mikelorant/muting/pkg/domainmapping"
+	"github.com/mikelorant/muting/pkg/events"
+	"github.com/mikelorant/muting/pkg/mutationconfig"
 	"github.com/mikelorant/muting/pkg/mutator"
+	"github.com/mikelorant/muting/pkg/validator"
+	"github.com/mikelorant/muting/pkg/watcher"
 )
 
 type ServerConfig struct {
-	Bind        string `mapstructure:"bind"`
-	Sources     string `mapstructure:"sources"`
-	Target      string `mapstructure:"target"`
-	Certificate string `mapstructure:"certificate"`
-	Key         string `mapstructure:"key"`
+	Bind        string   `mapstructure:"bind"`
+	Mappings    []string `mapstructure:"mapping"`
+	MappingFile string   `mapstructure:"mapping_file"`
+	Annotations []string `mapstructure:"annotation"`
+	Passthrough bool     `mapstructure:"dry_run_passthrough"`
+	Events      bool     `mapstructure:"events"`
+	API         bool     `mapstructure:"domain_mappings"`
+	Allowed     []string `mapstructure:"allowed_domain"`
+	Certificate string   `mapstructure:"certificate"`
+	Key         string   `mapstructure:"key"`
+
+	Rotate      bool          `mapstructure:"rotate"`
+	RenewBefore time.Duration `mapstructure:"renew_before"`
+	WebhookName string        `mapstructure:"webhook_name"`
+	Secret      string        `mapstructure:"secret"`
+	Namespace   string        `mapstructure:"namespace"`
 }
 
 var (
@@ -32,30 +60,74 @@ var (
 		},
 	}
 
-	serverConfig ServerConfig
+	serverConfig    ServerConfig
+	validatorConfig validator.Config
+
+	// mutatorConfig holds the *mutator.Config requests are mutated with,
+	// swapped as a whole when the mapping file or domain mappings change
+	mutatorConfig atomic.Value
+
+	// mappingsMu guards the mappings combined into the mapping of
+	// mutatorConfig
+	mappingsMu  sync.Mutex
+	fileMapping *mutator.Mapping
+	apiMapping  *mutator.Mapping
+
+	// namespaceLabelsOnce starts the namespace informer of
+	// sharedNamespaceLabels the first time a mapping selects labels
+	namespaceLabelsOnce   sync.Once
+	namespaceLabelsLookup mutator.NamespaceLabels
+)
+
+const (
+	// requestContextKey holds the context of the admission request being served
+	requestContextKey = "request_context"
+
+	// namespaceLookupTimeout bounds looking up a namespace missing from the
+	// informer cache, well within the webhook timeout
+	namespaceLookupTimeout = 2 * time.Second
 )
 
 func init() {
 	cobra.OnInitialize(initServerConfig)
 	rootCmd.AddCommand(serverCmd)
 	serverCmd.Flags().StringP("bind", "b", ":6883", "Address to bind")
-	serverCmd.Flags().StringP("sources", "s", "", "Source domains")
-	serverCmd.Flags().StringP("target", "t", "", "Target domain")
+	serverCmd.Flags().StringArrayP("mapping", "m", nil, "Domain mapping as source=target (repeatable, first match wins)")
+	serverCmd.Flags().StringP("mapping-file", "f", "", "Namespace domain mapping file")
+	serverCmd.Flags().StringArrayP("annotation", "a", nil, "Annotation key with hosts to rewrite (repeatable)")
+	serverCmd.Flags().BoolP("dry-run-passthrough", "", false, "Answer dry run requests with a warning describing the patch instead of the patch")
+	serverCmd.Flags().BoolP("events", "", false, "Record an event on each object with rewritten hosts")
+	serverCmd.Flags().BoolP("domain-mappings", "", false, "Watch DomainMapping and ClusterDomainMapping resources for domain mappings")
+	serverCmd.Flags().StringArrayP("allowed-domain", "d", nil, "Domain hosts are allowed in when validating (repeatable)")
 	serverCmd.Flags().StringP("certificate", "c", "/tmp/tls/tls.crt", "Certificate file")
 	serverCmd.Flags().StringP("key", "k", "/tmp/tls/tls.key", "Key file")
+	serverCmd.Flags().BoolP("rotate", "", false, "Renew the certificates in the certificate directory before they expire")
+	serverCmd.Flags().DurationP("renew-before", "", 30*24*time.Hour, "How long before the server certificate expires it is renewed")
+	serverCmd.Flags().StringP("webhook-name", "", "muting", "Webhook configuration name to publish renewed CA certificates to")
+	serverCmd.Flags().StringP("secret", "", "", "Secret to store renewed certificates in, so they are reused on restart")
+	serverCmd.Flags().StringP("namespace", "", "default", "Webhook namespace")
 	// https://github.com/spf13/viper/issues/397
-	// serverCmd.MarkFlagRequired("sources")
-	// serverCmd.MarkFlagRequired("target")
+	// serverCmd.MarkFlagRequired("mapping")
 }
 
 func initServerConfig() {
 	viper.SetEnvPrefix("server")
 	viper.AutomaticEnv()
 	viper.BindPFlag("bind", serverCmd.Flags().Lookup("bind"))
-	viper.BindPFlag("sources", serverCmd.Flags().Lookup("sources"))
-	viper.BindPFlag("target", serverCmd.Flags().Lookup("target"))
+	viper.BindPFlag("mapping", serverCmd.Flags().Lookup("mapping"))
+	viper.BindPFlag("mapping_file", serverCmd.Flags().Lookup("mapping-file"))
+	viper.BindPFlag("annotation", serverCmd.Flags().Lookup("annotation"))
+	viper.BindPFlag("dry_run_passthrough", serverCmd.Flags().Lookup("dry-run-passthrough"))
+	viper.BindPFlag("events", serverCmd.Flags().Lookup("events"))
+	viper.BindPFlag("domain_mappings", serverCmd.Flags().Lookup("domain-mappings"))
+	viper.BindPFlag("allowed_domain", serverCmd.Flags().Lookup("allowed-domain"))
 	viper.BindPFlag("certificate", serverCmd.Flags().Lookup("certificate"))
 	viper.BindPFlag("key", serverCmd.Flags().Lookup("key"))
+	viper.BindPFlag("rotate", serverCmd.Flags().Lookup("rotate"))
+	viper.BindPFlag("renew_before", serverCmd.Flags().Lookup("renew-before"))
+	viper.BindPFlag("webhook_name", serverCmd.Flags().Lookup("webhook-name"))
+	viper.BindPFlag("secret", serverCmd.Flags().Lookup("secret"))
+	viper.BindPFlag("namespace", serverCmd.Flags().Lookup("namespace"))
 
 	if err := viper.Unmarshal(&serverConfig); err != nil {
 		log.Fatal(err)
@@ -65,17 +137,124 @@ func initServerConfig() {
 }
 
 func doServer() {
+	config, err := newMutatorConfig(serverConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if serverConfig.Events {
+		recorder := events.NewRecorder(mutationconfig.CreateClient())
+		defer recorder.Shutdown()
+		config.Recorder = recorder
+	}
+	fileMapping = config.Mapping
+	mutatorConfig.Store(config)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	if serverConfig.MappingFile != "" {
+		if err := watcher.Watch(serverConfig.MappingFile, reloadMutatorConfig, stop); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if serverConfig.API {
+		if err := domainmapping.Watch(mutationconfig.CreateDynamicClient(), updateAPIMapping, stop); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	e := echo.New()
 
-	e.Use(middleware.Logger())
+	e.Use(accessLog())
 	e.Use(middleware.Recover())
 
 	e.GET("/health", health)
 	e.Any("/mutate", mutate)
 
-	if err := e.StartTLS(serverConfig.Bind, serverConfig.Certificate, serverConfig.Key); err != http.ErrServerClosed {
+	// validation is only served when domains are allowed
+	if len(serverConfig.Allowed) > 0 {
+		validatorConfig = validator.Config{
+			Domains:     serverConfig.Allowed,
+			Annotations: serverConfig.Annotations,
+		}
+		e.Any("/validate", validate)
+	}
+
+	// serve the certificate from its files as they are renewed
+	keyPair, err := certificates.NewKeyPairReloader(serverConfig.Certificate, serverConfig.Key)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := keyPair.Watch(stop); err != nil {
 		log.Fatal(err)
 	}
+
+	if serverConfig.Rotate {
+		client := mutationconfig.CreateClient()
+		rotator := &certificates.Rotator{
+			Dir:         filepath.Dir(serverConfig.Certificate),
+			RenewBefore: serverConfig.RenewBefore,
+			Publish: func(caCert []byte) error {
+				return mutationconfig.PatchCABundle(client, serverConfig.WebhookName, caCert)
+			},
+		}
+		if serverConfig.Secret != "" {
+			rotator.Store = func(caConfig *certificates.CAConfig, certConfig *certificates.ServerConfig) error {
+				return certificates.WriteSecret(client, serverConfig.Namespace, serverConfig.Secret, caConfig, certConfig)
+			}
+		}
+		if err := rotator.Start(stop); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	s := &http.Server{
+		Addr: serverConfig.Bind,
+		TLSConfig: &tls.Config{
+			GetCertificate: keyPair.GetCertificate,
+		},
+	}
+	if err := e.StartServer(s); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+// accessLog logs each request along with the admission request it carries,
+// so dry runs can be told apart from requests that are persisted
+func accessLog() echo.MiddlewareFunc {
+	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		LogRemoteIP: true,
+		LogMethod:   true,
+		LogURI:      true,
+		LogStatus:   true,
+		LogLatency:  true,
+		LogError:    true,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			fields := logrus.Fields{
+				"remote_ip": v.RemoteIP,
+				"method":    v.Method,
+				"uri":       v.URI,
+				"status":    v.Status,
+				"latency":   v.Latency.String(),
+			}
+			if v.Error != nil {
+				fields["error"] = v.Error.Error()
+			}
+			if ctx, ok := c.Get(requestContextKey).(mutator.RequestContext); ok {
+				fields["uid"] = ctx.UID
+				fields["kind"] = ctx.Kind.Kind
+				fields["namespace"] = ctx.Namespace
+				fields["name"] = ctx.Name
+				fields["operation"] = ctx.Operation
+				fields["user"] = ctx.User
+				fields["dry_run"] = ctx.DryRun
+			}
+			logrus.WithFields(fields).Info("request")
+			return nil
+		},
+	})
 }
 
 func health(c echo.Context) error {
@@ -88,7 +267,14 @@ func mutate(c echo.Context) error {
 		return c.String(http.StatusInternalServerError, "malformed request")
 	}
 
-	mutated, err := mutator.Mutate(body, serverConfig.Sources, serverConfig.Target)
+	review, err := mutator.DecodeReview(body)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+	c.Set(requestContextKey, review.Context)
+
+	config := mutatorConfig.Load().(*mutator.Config)
+	mutated, err := mutator.MutateReview(review, config)
 	if err != nil {
 		if _, ok := err.(*mutator.BadRequest); ok {
 			return c.String(http.StatusBadRequest, "bad request")
@@ -99,13 +285,179 @@ func mutate(c echo.Context) error {
 	return c.JSONBlob(http.StatusOK, mutated)
 }
 
+func validate(c echo.Context) error {
+	body, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "malformed request")
+	}
+
+	review, err := mutator.DecodeReview(body)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "bad request")
+	}
+	c.Set(requestContextKey, review.Context)
+
+	validated, err := validator.ValidateReview(review, &validatorConfig)
+	if err != nil {
+		if _, ok := err.(*mutator.BadRequest); ok {
+			return c.String(http.StatusBadRequest, "bad request")
+		}
+		return c.String(http.StatusInternalServerError, "internal server error")
+	}
+
+	return c.JSONBlob(http.StatusOK, validated)
+}
+
+// reloadMutatorConfig swaps in the domain mapping of the changed mapping
+// file. Requests being served keep the mapping they started with, and an
+// invalid mapping file is refused in favour of the current mapping.
+func reloadMutatorConfig() {
+	mapping, err := loadMapping(serverConfig)
+	if err != nil {
+		logrus.WithError(err).Error("Refusing to reload mapping")
+		return
+	}
+
+	mappingsMu.Lock()
+	defer mappingsMu.Unlock()
+	fileMapping = mapping
+	swapMapping()
+}
+
+// updateAPIMapping swaps in the mapping of the changed domain mappings
+func updateAPIMapping(mapping *mutator.Mapping) {
+	mappingsMu.Lock()
+	defer mappingsMu.Unlock()
+	apiMapping = mapping
+	swapMapping()
+}
+
+// swapMapping swaps in the mapping of the domain mappings combined with the
+// mapping of the flags and mapping file, which the domain mappings take
+// precedence over, and logs the rules that changed. mappingsMu must be held.
+func swapMapping() {
+	current := mutatorConfig.Load().(*mutator.Config)
+	mapping := mutator.CombineMappings(apiMapping, fileMapping)
+
+	config := *current
+	config.Mapping = mapping
+	if mapping.SelectsLabels() && config.NamespaceLabels == nil {
+		config.NamespaceLabels = sharedNamespaceLabels()
+	}
+	mutatorConfig.Store(&config)
+
+	added, removed := mutator.DiffMappings(current.Mapping, mapping)
+	for _, line := range removed {
+		logrus.WithField("rule", line).Info("Removed mapping rule")
+	}
+	for _, line := range added {
+		logrus.WithField("rule", line).Info("Added mapping rule")
+	}
+	logrus.WithFields(logrus.Fields{
+		"added":   len(added),
+		"removed": len(removed),
+	}).Info("Reloaded mapping")
+}
+
+// newMutatorConfig builds the mutator configuration with the domain mapping
+// of loadMapping
+func newMutatorConfig(c ServerConfig) (*mutator.Config, error) {
+	mapping, err := loadMapping(c)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &mutator.Config{
+		Mapping:           mapping,
+		AllowEmptyMapping: c.API,
+		Annotations:       c.Annotations,
+		DryRunPassthrough: c.Passthrough,
+	}
+
+	if mapping.SelectsLabels() {
+		config.NamespaceLabels = sharedNamespaceLabels()
+	}
+
+	return config, nil
+}
+
+// loadMapping builds the domain mapping from the mapping file, with the
+// mapping flags as the default for namespaces no rule selects.
+func loadMapping(c ServerConfig) (*mutator.Mapping, error) {
+	mapping := &mutator.Mapping{}
+	if c.MappingFile != "" {
+		var err error
+		if mapping, err = mutator.LoadMapping(c.MappingFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(c.Mappings) > 0 {
+		rules, err := mutator.ParseRules(c.Mappings)
+		if err != nil {
+			return nil, err
+		}
+		mapping.Default = rules
+	}
+
+	// domain mappings may provide all of the rules
+	if mapping.Empty() && !c.API {
+		return nil, fmt.Errorf("no domains configured: set a mapping, a mapping file or watch domain mappings")
+	}
+
+	return mapping, nil
+}
+
+// sharedNamespaceLabels returns the namespace label lookup of the server,
+// which watches namespaces for as long as the server runs
+func sharedNamespaceLabels() mutator.NamespaceLabels {
+	namespaceLabelsOnce.Do(func() {
+		namespaceLabelsLookup = namespaceLabels(mutationconfig.CreateClient(), make(chan struct{}))
+	})
+
+	return namespaceLabelsLookup
+}
+
+// namespaceLabels looks up the labels of namespaces in an informer cache
+// until stop is closed. Namespaces missing from the cache, such as those just
+// created or looked up before the cache syncs, are looked up with the client.
+func namespaceLabels(client kubernetes.Interface, stop <-chan struct{}) mutator.NamespaceLabels {
+	factory := informers.NewSharedInformerFactory(client, 0)
+	lister := factory.Core().V1().Namespaces().Lister()
+	factory.Start(stop)
+
+	return func(namespace string) (map[string]string, error) {
+		if ns, err := lister.Get(namespace); err == nil {
+			return ns.Labels, nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), namespaceLookupTimeout)
+		defer cancel()
+		ns, err := client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return ns.Labels, nil
+	}
+}
+
 func (c ServerConfig) String() string {
 	formatting := heredoc.Doc(`
 			Bind: %s
-			Sources: %s
-			Target: %s
+			Mappings: %s
+			Mapping File: %s
+			Annotations: %s
+			Dry Run Passthrough: %t
+			Events: %t
+			Domain Mappings: %t
+			Allowed Domains: %s
 			Certificate: %s
 			Key: %s
+			Rotate: %t
+			Renew Before: %s
+			Webhook Name: %s
+			Secret: %s
+			Namespace: %s
 		`)
-	return fmt.Sprintf(formatting, c.Bind, c.Sources, c.Target, c.Certificate, c.Key)
+	return fmt.Sprintf(formatting, c.Bind, strings.Join(c.Mappings, ", "), c.MappingFile, strings.Join(c.Annotations, ", "), c.Passthrough, c.Events, c.API, strings.Join(c.Allowed, ", "), c.Certificate, c.Key, c.Rotate, c.RenewBefore, c.WebhookName, c.Secret, c.Namespace)
 }
@@ -9,9 +9,16 @@ import (
   "bytes"
   "encoding/base64"
   "fmt"
+  "path/filepath"
+  "time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/mikelorant/muting/pkg/mutator"
 )
 
 func TestHealth(t *testing.T) {
@@ -38,8 +45,13 @@ func TestMutate(t *testing.T) {
     blob map[string]interface{}
   )
 
-  serverConfig.Sources = "example.org"
-  serverConfig.Target = "example.com"
+  serverConfig.Mappings = []string{"example.org=example.com"}
+
+  config, err := newMutatorConfig(serverConfig)
+  if err != nil {
+    t.Fatal(err)
+  }
+  mutatorConfig.Store(config)
 
   jsonBlob, err := ioutil.ReadFile("testdata/admissionreview.json")
   if err != nil {
@@ -63,5 +75,107 @@ func TestMutate(t *testing.T) {
   }
 
   assert.Equal(http.StatusOK, rec.Code)
-  assert.Equal(`[{"op":"replace","path":"/spec/rules/0/host","value":"muting.example.com"}]`, string(patchDecoded))
+  assert.Equal(`[{"op":"replace","path":"/spec/rules/0/host","value":"muting.example.com"},{"op":"add","path":"/metadata/annotations/muting.io~1original-hosts","value":"{\"/spec/rules/0/host\":\"muting.example.org\"}"}]`, string(patchDecoded))
+}
+
+func TestValidate(t *testing.T) {
+  assert := assert.New(t)
+
+  e := echo.New()
+
+  var (
+    blob map[string]interface{}
+  )
+
+  validatorConfig.Domains = []string{"example.com"}
+
+  jsonBlob, err := ioutil.ReadFile("testdata/admissionreview.json")
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  req := httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader(jsonBlob))
+  rec := httptest.NewRecorder()
+
+  e.POST("/validate", validate)
+  e.ServeHTTP(rec, req)
+
+  if err = json.Unmarshal([]byte(rec.Body.String()), &blob); err != nil {
+    t.Fatal(err)
+  }
+
+  response := blob["response"].(map[string]interface{})
+  status := response["status"].(map[string]interface{})
+
+  assert.Equal(http.StatusOK, rec.Code)
+  assert.Equal(false, response["allowed"])
+  assert.Equal("Ingress hosts muting.example.org are outside the allowed domains example.com", status["message"])
+}
+
+func TestReloadMutatorConfig(t *testing.T) {
+  assert := assert.New(t)
+
+  file := filepath.Join(t.TempDir(), "mapping.yaml")
+  writeMapping := func(mapping string) {
+    if err := ioutil.WriteFile(file, []byte(mapping), 0644); err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  saved := serverConfig
+  defer func() { serverConfig = saved }()
+
+  serverConfig = ServerConfig{MappingFile: file}
+  writeMapping("default:\n- source: example.org\n  target: example.com\n")
+
+  config, err := newMutatorConfig(serverConfig)
+  if err != nil {
+    t.Fatal(err)
+  }
+  mutatorConfig.Store(config)
+
+  writeMapping("default:\n- source: example.org\n  target: example.net\n")
+  reloadMutatorConfig()
+  reloaded := mutatorConfig.Load().(*mutator.Config)
+  assert.Equal([]string{"default: suffix example.org=example.net"}, reloaded.Mapping.Describe())
+  assert.Equal([]string{"default: suffix example.org=example.com"}, config.Mapping.Describe())
+
+  writeMapping("default:\n- source: example.org\n")
+  reloadMutatorConfig()
+  assert.Same(reloaded, mutatorConfig.Load().(*mutator.Config))
+}
+
+func TestNamespaceLabels(t *testing.T) {
+  assert := assert.New(t)
+
+  client := fake.NewSimpleClientset(&corev1.Namespace{
+    ObjectMeta: metav1.ObjectMeta{Name: "staging", Labels: map[string]string{"environment": "staging"}},
+  })
+  stop := make(chan struct{})
+  defer close(stop)
+
+  lookup := namespaceLabels(client, stop)
+
+  // served from the cache once it syncs, otherwise from the client
+  labels, err := lookup("staging")
+  assert.NoError(err)
+  assert.Equal(map[string]string{"environment": "staging"}, labels)
+
+  // once the cache syncs namespaces are no longer fetched
+  gets := func() (n int) {
+    for _, action := range client.Actions() {
+      if action.GetVerb() == "get" {
+        n++
+      }
+    }
+    return n
+  }
+  assert.Eventually(func() bool {
+    before := gets()
+    labels, err := lookup("staging")
+    return err == nil && labels["environment"] == "staging" && gets() == before
+  }, time.Second, 10*time.Millisecond)
+
+  _, err = lookup("missing")
+  assert.Error(err)
 }
@@ -0,0 +1,164 @@
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto copies the spec into out
+func (in *DomainMappingSpec) DeepCopyInto(out *DomainMappingSpec) {
+	*out = *in
+	if in.Domains != nil {
+		out.Domains = make([]DomainRule, len(in.Domains))
+		copy(out.Domains, in.Domains)
+	}
+}
+
+// DeepCopy copies the spec
+func (in *DomainMappingSpec) DeepCopy() *DomainMappingSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DomainMappingSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies the domain mapping into out
+func (in *DomainMapping) DeepCopyInto(out *DomainMapping) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy copies the domain mapping
+func (in *DomainMapping) DeepCopy() *DomainMapping {
+	if in == nil {
+		return nil
+	}
+	out := new(DomainMapping)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject copies the domain mapping as a runtime.Object
+func (in *DomainMapping) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto copies the list into out
+func (in *DomainMappingList) DeepCopyInto(out *DomainMappingList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]DomainMapping, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+// DeepCopy copies the list
+func (in *DomainMappingList) DeepCopy() *DomainMappingList {
+	if in == nil {
+		return nil
+	}
+	out := new(DomainMappingList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject copies the list as a runtime.Object
+func (in *DomainMappingList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto copies the spec into out
+func (in *ClusterDomainMappingSpec) DeepCopyInto(out *ClusterDomainMappingSpec) {
+	*out = *in
+	if in.Namespaces != nil {
+		out.Namespaces = make([]string, len(in.Namespaces))
+		copy(out.Namespaces, in.Namespaces)
+	}
+	if in.Selector != nil {
+		out.Selector = in.Selector.DeepCopy()
+	}
+	if in.Domains != nil {
+		out.Domains = make([]DomainRule, len(in.Domains))
+		copy(out.Domains, in.Domains)
+	}
+}
+
+// DeepCopy copies the spec
+func (in *ClusterDomainMappingSpec) DeepCopy() *ClusterDomainMappingSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterDomainMappingSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies the cluster domain mapping into out
+func (in *ClusterDomainMapping) DeepCopyInto(out *ClusterDomainMapping) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy copies the cluster domain mapping
+func (in *ClusterDomainMapping) DeepCopy() *ClusterDomainMapping {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterDomainMapping)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject copies the cluster domain mapping as a runtime.Object
+func (in *ClusterDomainMapping) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto copies the list into out
+func (in *ClusterDomainMappingList) DeepCopyInto(out *ClusterDomainMappingList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]ClusterDomainMapping, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+// DeepCopy copies the list
+func (in *ClusterDomainMappingList) DeepCopy() *ClusterDomainMappingList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterDomainMappingList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject copies the list as a runtime.Object
+func (in *ClusterDomainMappingList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
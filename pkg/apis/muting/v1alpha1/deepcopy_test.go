@@ -0,0 +1,50 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestDeepCopy(t *testing.T) {
+	in := &ClusterDomainMappingList{
+		Items: []ClusterDomainMapping{{
+			ObjectMeta: metav1.ObjectMeta{Name: "preview", Labels: map[string]string{"a": "b"}},
+			Spec: ClusterDomainMappingSpec{
+				Namespaces: []string{"staging"},
+				Selector:   &metav1.LabelSelector{MatchLabels: map[string]string{"environment": "preview"}},
+				Domains:    []DomainRule{{Source: "example.org", Target: "example.com"}},
+			},
+		}},
+	}
+
+	out := in.DeepCopyObject().(*ClusterDomainMappingList)
+	assert.Equal(t, in, out)
+
+	out.Items[0].Labels["a"] = "c"
+	out.Items[0].Spec.Namespaces[0] = "other"
+	out.Items[0].Spec.Selector.MatchLabels["environment"] = "other"
+	out.Items[0].Spec.Domains[0].Target = "example.net"
+	assert.Equal(t, "b", in.Items[0].Labels["a"])
+	assert.Equal(t, "staging", in.Items[0].Spec.Namespaces[0])
+	assert.Equal(t, "preview", in.Items[0].Spec.Selector.MatchLabels["environment"])
+	assert.Equal(t, "example.com", in.Items[0].Spec.Domains[0].Target)
+
+	mapping := &DomainMapping{Spec: DomainMappingSpec{Domains: []DomainRule{{Source: "example.org", Target: "example.com"}}}}
+	copied := mapping.DeepCopy()
+	copied.Spec.Domains[0].Target = "example.net"
+	assert.Equal(t, "example.com", mapping.Spec.Domains[0].Target)
+}
+
+func TestAddToScheme(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if !assert.NoError(t, AddToScheme(scheme)) {
+		t.FailNow()
+	}
+
+	for _, kind := range []string{"DomainMapping", "DomainMappingList", "ClusterDomainMapping", "ClusterDomainMappingList"} {
+		assert.True(t, scheme.Recognizes(SchemeGroupVersion.WithKind(kind)), kind)
+	}
+}
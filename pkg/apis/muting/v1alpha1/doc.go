@@ -0,0 +1,3 @@
+// Package v1alpha1 contains the v1alpha1 muting.io API, the domain mappings
+// hosts are rewritten with
+package v1alpha1
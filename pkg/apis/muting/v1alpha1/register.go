@@ -0,0 +1,36 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// GroupName is the API group of the domain mappings
+const GroupName = "muting.io"
+
+var (
+	// SchemeGroupVersion is the group version of the types of this package
+	SchemeGroupVersion = schema.GroupVersion{Group: GroupName, Version: "v1alpha1"}
+
+	// DomainMappingResource is the resource of namespaced domain mappings
+	DomainMappingResource = SchemeGroupVersion.WithResource("domainmappings")
+	// ClusterDomainMappingResource is the resource of cluster domain mappings
+	ClusterDomainMappingResource = SchemeGroupVersion.WithResource("clusterdomainmappings")
+
+	// SchemeBuilder adds the types of this package to a scheme
+	SchemeBuilder = runtime.NewSchemeBuilder(addKnownTypes)
+	// AddToScheme adds the types of this package to a scheme
+	AddToScheme = SchemeBuilder.AddToScheme
+)
+
+func addKnownTypes(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(SchemeGroupVersion,
+		&DomainMapping{},
+		&DomainMappingList{},
+		&ClusterDomainMapping{},
+		&ClusterDomainMappingList{},
+	)
+	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
+	return nil
+}
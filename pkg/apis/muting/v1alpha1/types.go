@@ -0,0 +1,64 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DomainRule rewrites hosts matching the Source to the Target, as the rules
+// of a mapping file do. When no mode is given it is detected from the source.
+type DomainRule struct {
+	// Mode is one of suffix, wildcard or regex
+	Mode   string `json:"mode,omitempty"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// DomainMappingSpec holds the ordered rules of a domain mapping
+type DomainMappingSpec struct {
+	Domains []DomainRule `json:"domains"`
+}
+
+// DomainMapping rewrites the hosts of the resources in its namespace. It
+// takes precedence over cluster domain mappings.
+type DomainMapping struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec DomainMappingSpec `json:"spec"`
+}
+
+// DomainMappingList is a list of domain mappings
+type DomainMappingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []DomainMapping `json:"items"`
+}
+
+// ClusterDomainMappingSpec holds the ordered rules of a cluster domain
+// mapping and the namespaces they apply to
+type ClusterDomainMappingSpec struct {
+	// Namespaces selects namespaces by name
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Selector selects namespaces by label
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	Domains []DomainRule `json:"domains"`
+}
+
+// ClusterDomainMapping rewrites the hosts of the resources in the namespaces
+// it selects, or in every namespace when it selects none
+type ClusterDomainMapping struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ClusterDomainMappingSpec `json:"spec"`
+}
+
+// ClusterDomainMappingList is a list of cluster domain mappings
+type ClusterDomainMappingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []ClusterDomainMapping `json:"items"`
+}
@@ -0,0 +1,47 @@
+package certificates
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+)
+
+// MergeCABundle returns a CA bundle of the CA certificate followed by the
+// certificates of the bundle that are still valid at the given time, so
+// certificates signed by either are trusted while servers move to the new CA.
+// Each certificate is only included once.
+func MergeCABundle(bundle []byte, caCert []byte, now time.Time) []byte {
+	merged := bytes.NewBuffer(append([]byte{}, caCert...))
+
+	seen := map[string]bool{}
+	for rest := caCert; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		seen[string(block.Bytes)] = true
+	}
+
+	for {
+		var block *pem.Block
+		block, bundle = pem.Decode(bundle)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" || seen[string(block.Bytes)] {
+			continue
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil || now.After(certificate.NotAfter) {
+			continue
+		}
+
+		seen[string(block.Bytes)] = true
+		pem.Encode(merged, block)
+	}
+
+	return merged.Bytes()
+}
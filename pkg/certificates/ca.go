@@ -2,12 +2,11 @@ package certificates
 
 import (
 	"bytes"
+	"crypto"
 	cryptorand "crypto/rand"
-	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
-	"math/big"
 	"time"
 	"fmt"
 )
@@ -15,15 +14,31 @@ import (
 type CAConfig struct {
 	certificate    *x509.Certificate
 	certificatePEM bytes.Buffer
-	key            *rsa.PrivateKey
+	key            crypto.Signer
+	keyPEM         bytes.Buffer
+	validity       time.Duration
+	excludeKey     bool
 }
 
-func NewCACertificate() (ca CAConfig, err error) {
-	if err = ca.genKey(); err != nil {
+// NewCACertificate generates a CA with a key of the algorithm, valid for the
+// validity period
+func NewCACertificate(algorithm KeyAlgorithm, validity time.Duration) (ca CAConfig, err error) {
+	if validity <= 0 {
+		return ca, fmt.Errorf("NewCACertificate: invalid validity period: %s", validity)
+	}
+	ca.validity = validity
+
+	if err = ca.genKey(algorithm); err != nil {
 		return ca, fmt.Errorf("NewCACertificate: genKey failed: %w", err)
 	}
 
-	ca.genCertificate()
+	if err = ca.genKeyPEM(); err != nil {
+		return ca, fmt.Errorf("NewCACertificate: genKeyPEM failed: %w", err)
+	}
+
+	if err = ca.genCertificate(); err != nil {
+		return ca, fmt.Errorf("NewCACertificate: genCertificate failed: %w", err)
+	}
 
 	if err = ca.genCertificatePEM(); err != nil {
 		return ca, fmt.Errorf("NewCACertificate: genCertificate failed: %w", err)
@@ -32,12 +47,81 @@ func NewCACertificate() (ca CAConfig, err error) {
 	return ca, err
 }
 
+// LoadCA loads a CA from its PEM encoded certificate and key. The CA may be
+// an intermediate CA, with the certificates of its chain following its own.
+func LoadCA(certPEM []byte, keyPEM []byte) (ca CAConfig, err error) {
+	chain, err := parseCertificates(certPEM)
+	if err != nil {
+		return ca, fmt.Errorf("LoadCA: %w", err)
+	}
+	if len(chain) == 0 {
+		return ca, fmt.Errorf("LoadCA: no certificate PEM")
+	}
+	ca.certificate = chain[0]
+
+	if !ca.certificate.IsCA {
+		return ca, fmt.Errorf("LoadCA: certificate is not a CA")
+	}
+
+	if ca.certificate.KeyUsage != 0 && ca.certificate.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return ca, fmt.Errorf("LoadCA: certificate is not for signing certificates")
+	}
+
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return ca, fmt.Errorf("LoadCA: no private key PEM")
+	}
+
+	if ca.key, err = parseKey(keyBlock); err != nil {
+		return ca, fmt.Errorf("LoadCA: %w", err)
+	}
+
+	if !keyMatches(ca.key, ca.certificate.PublicKey) {
+		return ca, fmt.Errorf("LoadCA: key does not match certificate")
+	}
+	ca.validity = ca.certificate.NotAfter.Sub(ca.certificate.NotBefore)
+
+	for _, certificate := range chain {
+		if err = pem.Encode(&ca.certificatePEM, &pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw}); err != nil {
+			return ca, fmt.Errorf("LoadCA: unable to PEM encode certificate: %w", err)
+		}
+	}
+
+	if err = pem.Encode(&ca.keyPEM, keyBlock); err != nil {
+		return ca, fmt.Errorf("LoadCA: unable to PEM encode key: %w", err)
+	}
+
+	return ca, nil
+}
+
+// ExcludeKey keeps the CA key from being written along with the
+// certificates, for a CA whose key is kept elsewhere
+func (c *CAConfig) ExcludeKey() {
+	c.excludeKey = true
+}
+
 func (c *CAConfig) GetCertificatePEM() *bytes.Buffer {
 	return &c.certificatePEM
 }
 
-func (c *CAConfig) genKey() (err error) {
-	c.key, err = rsa.GenerateKey(cryptorand.Reader, 4096)
+func (c *CAConfig) GetKeyPEM() *bytes.Buffer {
+	return &c.keyPEM
+}
+
+// ValidFor reports whether the CA certificate is valid for at least the
+// given duration
+func (c *CAConfig) ValidFor(d time.Duration) bool {
+	now := time.Now()
+	return !now.Before(c.certificate.NotBefore) && now.Add(d).Before(c.certificate.NotAfter)
+}
+
+// intermediate reports whether the CA is signed by another CA
+func (c *CAConfig) intermediate() bool {
+	return !bytes.Equal(c.certificate.RawIssuer, c.certificate.RawSubject)
+}
+
+func (c *CAConfig) genKey(algorithm KeyAlgorithm) (err error) {
+	c.key, err = generateKey(algorithm)
 	if err != nil {
 		return fmt.Errorf("genKey: unable to generate key: %w", err)
 	}
@@ -45,28 +129,53 @@ func (c *CAConfig) genKey() (err error) {
 	return err
 }
 
-func (c *CAConfig) genCertificate() {
+func (c *CAConfig) genKeyPEM() (err error) {
+	block, err := encodeKey(c.key)
+	if err != nil {
+		return fmt.Errorf("genKeyPEM: %w", err)
+	}
+
+	err = pem.Encode(&c.keyPEM, block)
+	if err != nil {
+		return fmt.Errorf("genKeyPEM: unable to create key PEM: %w", err)
+	}
+
+	return err
+}
+
+func (c *CAConfig) genCertificate() (err error) {
+	serial, err := randomSerial()
+	if err != nil {
+		return fmt.Errorf("genCertificate: %w", err)
+	}
+
+	keyID, err := keyIdentifier(c.key.Public())
+	if err != nil {
+		return fmt.Errorf("genCertificate: %w", err)
+	}
+
+	// the CA only signs the server certificates
 	c.certificate = &x509.Certificate{
-		SerialNumber:          big.NewInt(2020),
+		SerialNumber:          serial,
 		Subject:               pkix.Name{
 			Organization:        []string{"muting.io"},
 		},
 		NotBefore:             time.Now(),
-		NotAfter:              time.Now().AddDate(1, 0, 0),
+		NotAfter:              time.Now().Add(c.validity),
 		IsCA:                  true,
-		ExtKeyUsage:           []x509.ExtKeyUsage{
-			x509.ExtKeyUsageClientAuth,
-			x509.ExtKeyUsageServerAuth,
-		},
-		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		MaxPathLenZero:        true,
+		SubjectKeyId:          keyID,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
 		BasicConstraintsValid: true,
 	}
+
+	return err
 }
 
 func (c *CAConfig) genCertificatePEM() (err error) {
 	var cert []byte
 
-	cert, err = x509.CreateCertificate(cryptorand.Reader, c.certificate, c.certificate, &c.key.PublicKey, c.key)
+	cert, err = x509.CreateCertificate(cryptorand.Reader, c.certificate, c.certificate, c.key.Public(), c.key)
 	if err != nil {
 		return fmt.Errorf("genCertificatePEM: unable to create certificate PEM: %w", err)
 	}
@@ -0,0 +1,218 @@
+package certificates
+
+import (
+	"crypto"
+	cryptorand "crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCACertificate(t *testing.T) {
+	tc := []struct {
+		name      string
+		algorithm KeyAlgorithm
+	}{
+		{name: "rsa", algorithm: RSA2048},
+		{name: "ecdsa", algorithm: ECDSAP256},
+		{name: "ed25519", algorithm: Ed25519},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			ca, err := NewCACertificate(tt.algorithm, 24*time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cert := parseCertificatePEM(t, ca.GetCertificatePEM().Bytes())
+
+			assert.True(t, cert.IsCA)
+			assert.True(t, cert.BasicConstraintsValid)
+			assert.Equal(t, x509.KeyUsageCertSign|x509.KeyUsageCRLSign, cert.KeyUsage)
+			assert.Empty(t, cert.ExtKeyUsage)
+			assert.Equal(t, 1, cert.SerialNumber.Sign())
+			assert.LessOrEqual(t, cert.SerialNumber.BitLen(), 129)
+
+			keyID, err := keyIdentifier(cert.PublicKey)
+			assert.NoError(t, err)
+			assert.Equal(t, keyID, cert.SubjectKeyId)
+
+			assert.WithinDuration(t, cert.NotBefore.Add(24*time.Hour), cert.NotAfter, time.Second)
+			assert.NoError(t, cert.CheckSignatureFrom(cert))
+		})
+	}
+}
+
+func TestNewCACertificateSerials(t *testing.T) {
+	first, err := NewCACertificate(ECDSAP256, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewCACertificate(ECDSAP256, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NotEqual(t, first.certificate.SerialNumber, second.certificate.SerialNumber)
+	assert.NotEqual(t, first.certificate.SubjectKeyId, second.certificate.SubjectKeyId)
+}
+
+func TestNewCACertificateInvalidValidity(t *testing.T) {
+	_, err := NewCACertificate(ECDSAP256, 0)
+	assert.Error(t, err)
+}
+
+func TestLoadCA(t *testing.T) {
+	ca, err := NewCACertificate(ECDSAP256, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadCA(ca.GetCertificatePEM().Bytes(), ca.GetKeyPEM().Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, ca.GetCertificatePEM().String(), loaded.GetCertificatePEM().String())
+	assert.True(t, loaded.ValidFor(time.Minute))
+	assert.False(t, loaded.ValidFor(2*time.Hour))
+
+	other, err := NewCACertificate(ECDSAP256, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadCA(ca.GetCertificatePEM().Bytes(), other.GetKeyPEM().Bytes())
+	assert.Error(t, err)
+}
+
+func TestLoadCAIntermediate(t *testing.T) {
+	rootCert, rootKey := newTestCA(t, "root", nil, nil)
+	intermediateCert, intermediateKey := newTestCA(t, "intermediate", rootCert, rootKey)
+
+	keyBlock, err := encodeKey(intermediateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := append(pemCertificate(intermediateCert), pemCertificate(rootCert)...)
+
+	ca, err := LoadCA(certPEM, pem.EncodeToMemory(keyBlock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "intermediate", ca.certificate.Subject.CommonName)
+	assert.Equal(t, string(certPEM), ca.GetCertificatePEM().String())
+
+	server, err := NewServerCertificate(&ca, "muting", []string{"muting"}, ECDSAP256, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the server certificate is served with the chain
+	var chain []*x509.Certificate
+	for rest := server.certificatePEM.Bytes(); ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		chain = append(chain, parseCertificatePEM(t, pem.EncodeToMemory(block)))
+	}
+	if assert.Len(t, chain, 3) {
+		roots := x509.NewCertPool()
+		roots.AddCert(rootCert)
+		intermediates := x509.NewCertPool()
+		intermediates.AddCert(chain[1])
+		_, err = chain[0].Verify(x509.VerifyOptions{
+			DNSName:       "muting",
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		assert.NoError(t, err)
+	}
+}
+
+func TestLoadCANotCA(t *testing.T) {
+	ca, err := NewCACertificate(ECDSAP256, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewServerCertificate(&ca, "muting", []string{"muting"}, ECDSAP256, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = LoadCA(server.certificatePEM.Bytes(), server.keyPEM.Bytes())
+	assert.Error(t, err)
+}
+
+// newTestCertificates returns a CA and a server certificate it signs, each
+// valid for its validity period
+func newTestCertificates(t *testing.T, caValidity time.Duration, validity time.Duration) (CAConfig, ServerConfig) {
+	t.Helper()
+
+	caConfig, err := NewCACertificate(ECDSAP256, caValidity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig, err := NewServerCertificate(&caConfig, "muting.default.svc", []string{"muting", "muting.default.svc"}, ECDSAP256, validity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return caConfig, serverConfig
+}
+
+func pemCertificate(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// newTestCA returns a CA signed by the parent, or self-signed without one
+func newTestCA(t *testing.T, commonName string, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+
+	key, err := generateKey(ECDSAP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(cryptorand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+func parseCertificatePEM(t *testing.T, data []byte) *x509.Certificate {
+	t.Helper()
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatal("no certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
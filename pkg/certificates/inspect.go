@@ -0,0 +1,108 @@
+package certificates
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+)
+
+// Inspection is the outcome of inspecting a server certificate
+type Inspection struct {
+	CommonName string
+	DNSNames   []string
+	// NotAfter is the earliest expiry of the certificate and its chain
+	NotAfter time.Time
+	// Problems are the checks the certificate failed
+	Problems []string
+}
+
+// DaysLeft returns the number of whole days until the certificate expires
+func (i *Inspection) DaysLeft(now time.Time) int {
+	return int(i.NotAfter.Sub(now).Hours() / 24)
+}
+
+// Inspect checks that the server certificate chains to a CA of the CA bundle,
+// is valid for the DNS names and belongs to the key
+func Inspect(caBundle []byte, certPEM []byte, keyPEM []byte, dnsNames []string, now time.Time) (inspection Inspection, err error) {
+	chain, err := parseCertificates(certPEM)
+	if err != nil {
+		return inspection, fmt.Errorf("Inspect: server certificate: %w", err)
+	}
+	if len(chain) == 0 {
+		return inspection, fmt.Errorf("Inspect: no server certificate")
+	}
+	certificate := chain[0]
+
+	inspection.CommonName = certificate.Subject.CommonName
+	inspection.DNSNames = certificate.DNSNames
+	inspection.NotAfter = certificate.NotAfter
+
+	cas, err := parseCertificates(caBundle)
+	if err != nil {
+		return inspection, fmt.Errorf("Inspect: CA bundle: %w", err)
+	}
+
+	roots := x509.NewCertPool()
+	for _, ca := range cas {
+		roots.AddCert(ca)
+	}
+	intermediates := x509.NewCertPool()
+	for _, intermediate := range chain[1:] {
+		intermediates.AddCert(intermediate)
+	}
+
+	if len(cas) == 0 {
+		inspection.Problems = append(inspection.Problems, "CA bundle is empty")
+	} else if verified, err := certificate.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}); err != nil {
+		inspection.Problems = append(inspection.Problems, fmt.Sprintf("certificate does not verify: %s", err))
+	} else {
+		for _, ca := range verified[0][1:] {
+			if ca.NotAfter.Before(inspection.NotAfter) {
+				inspection.NotAfter = ca.NotAfter
+			}
+		}
+	}
+
+	for _, name := range dnsNames {
+		if err := certificate.VerifyHostname(name); err != nil {
+			inspection.Problems = append(inspection.Problems, fmt.Sprintf("certificate is not valid for %s", name))
+		}
+	}
+
+	if keyBlock, _ := pem.Decode(keyPEM); keyBlock == nil {
+		inspection.Problems = append(inspection.Problems, "no private key PEM")
+	} else if key, err := parseKey(keyBlock); err != nil {
+		inspection.Problems = append(inspection.Problems, fmt.Sprintf("unable to parse key: %s", err))
+	} else if !keyMatches(key, certificate.PublicKey) {
+		inspection.Problems = append(inspection.Problems, "key does not match certificate")
+	}
+
+	return inspection, nil
+}
+
+// parseCertificates parses the certificates of PEM data
+func parseCertificates(data []byte) (certificates []*x509.Certificate, err error) {
+	for rest := data; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parseCertificates: unable to parse certificate: %w", err)
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	return certificates, nil
+}
@@ -0,0 +1,127 @@
+package certificates
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInspect(t *testing.T) {
+	ca, err := NewCACertificate(ECDSAP256, 96*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewServerCertificate(&ca, "muting.default.svc", []string{"muting", "muting.default", "muting.default.svc"}, ECDSAP256, 72*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notAfter := parseCertificatePEM(t, server.certificatePEM.Bytes()).NotAfter
+	other, err := NewCACertificate(ECDSAP256, 48*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	tc := []struct {
+		name     string
+		caBundle []byte
+		keyPEM   []byte
+		dnsNames []string
+		now      time.Time
+		problems int
+		daysLeft int
+	}{
+		{
+			name:     "valid",
+			caBundle: ca.GetCertificatePEM().Bytes(),
+			keyPEM:   server.keyPEM.Bytes(),
+			dnsNames: []string{"muting", "muting.default.svc"},
+			now:      now,
+			daysLeft: 2,
+		},
+		{
+			name:     "bundle of CAs",
+			caBundle: append(append([]byte{}, other.GetCertificatePEM().Bytes()...), ca.GetCertificatePEM().Bytes()...),
+			keyPEM:   server.keyPEM.Bytes(),
+			now:      now.Add(24 * time.Hour),
+			daysLeft: 1,
+		},
+		{
+			name:     "unknown CA",
+			caBundle: other.GetCertificatePEM().Bytes(),
+			keyPEM:   server.keyPEM.Bytes(),
+			now:      now,
+			problems: 1,
+		},
+		{
+			name:     "empty CA bundle",
+			keyPEM:   server.keyPEM.Bytes(),
+			now:      now,
+			problems: 1,
+		},
+		{
+			name:     "expired",
+			caBundle: ca.GetCertificatePEM().Bytes(),
+			keyPEM:   server.keyPEM.Bytes(),
+			now:      now.Add(73 * time.Hour),
+			problems: 1,
+		},
+		{
+			name:     "DNS name mismatch",
+			caBundle: ca.GetCertificatePEM().Bytes(),
+			keyPEM:   server.keyPEM.Bytes(),
+			dnsNames: []string{"muting.other", "muting.other.svc"},
+			now:      now,
+			problems: 2,
+		},
+		{
+			name:     "key mismatch",
+			caBundle: ca.GetCertificatePEM().Bytes(),
+			keyPEM:   ca.GetKeyPEM().Bytes(),
+			now:      now,
+			problems: 1,
+		},
+		{
+			name:     "no key",
+			caBundle: ca.GetCertificatePEM().Bytes(),
+			now:      now,
+			problems: 1,
+		},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			inspection, err := Inspect(tt.caBundle, server.certificatePEM.Bytes(), tt.keyPEM, tt.dnsNames, tt.now)
+			assert.NoError(t, err)
+			assert.Len(t, inspection.Problems, tt.problems, inspection.Problems)
+			assert.Equal(t, "muting.default.svc", inspection.CommonName)
+			assert.Equal(t, notAfter, inspection.NotAfter)
+			if tt.problems == 0 {
+				assert.Equal(t, tt.daysLeft, inspection.DaysLeft(tt.now))
+			}
+		})
+	}
+}
+
+func TestInspectCAExpiry(t *testing.T) {
+	root, rootKey := newTestCA(t, "root", nil, nil)
+	intermediate, intermediateKey := newTestCA(t, "intermediate", root, rootKey)
+	ca := CAConfig{certificate: intermediate, key: intermediateKey}
+	server, err := NewServerCertificate(&ca, "muting", []string{"muting"}, ECDSAP256, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caBundle := pemCertificate(root)
+	inspection, err := Inspect(caBundle, append(server.certificatePEM.Bytes(), pemCertificate(intermediate)...), server.keyPEM.Bytes(), []string{"muting"}, time.Now())
+	assert.NoError(t, err)
+	assert.Empty(t, inspection.Problems)
+	// the server certificate expires with its CA, which expires with the root
+	assert.Equal(t, root.NotAfter, inspection.NotAfter)
+}
+
+func TestInspectInvalid(t *testing.T) {
+	_, err := Inspect(nil, nil, nil, nil, time.Now())
+	assert.Error(t, err)
+}
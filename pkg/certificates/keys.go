@@ -0,0 +1,170 @@
+package certificates
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// KeyAlgorithm is the algorithm and size of a generated key
+type KeyAlgorithm string
+
+const (
+	RSA2048   KeyAlgorithm = "rsa2048"
+	RSA3072   KeyAlgorithm = "rsa3072"
+	RSA4096   KeyAlgorithm = "rsa4096"
+	ECDSAP256 KeyAlgorithm = "ecdsa-p256"
+	ECDSAP384 KeyAlgorithm = "ecdsa-p384"
+	Ed25519   KeyAlgorithm = "ed25519"
+)
+
+// KeyAlgorithms are the supported key algorithms
+var KeyAlgorithms = []KeyAlgorithm{RSA2048, RSA3072, RSA4096, ECDSAP256, ECDSAP384, Ed25519}
+
+// ParseKeyAlgorithm returns the key algorithm with the given name
+func ParseKeyAlgorithm(name string) (KeyAlgorithm, error) {
+	for _, algorithm := range KeyAlgorithms {
+		if strings.EqualFold(name, string(algorithm)) {
+			return algorithm, nil
+		}
+	}
+
+	return "", fmt.Errorf("ParseKeyAlgorithm: unsupported key algorithm: %s", name)
+}
+
+// generateKey generates a private key with the algorithm
+func generateKey(algorithm KeyAlgorithm) (crypto.Signer, error) {
+	switch algorithm {
+	case RSA2048:
+		return rsa.GenerateKey(cryptorand.Reader, 2048)
+	case RSA3072:
+		return rsa.GenerateKey(cryptorand.Reader, 3072)
+	case RSA4096:
+		return rsa.GenerateKey(cryptorand.Reader, 4096)
+	case ECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+	case ECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), cryptorand.Reader)
+	case Ed25519:
+		_, key, err := ed25519.GenerateKey(cryptorand.Reader)
+		return key, err
+	}
+
+	return nil, fmt.Errorf("generateKey: unsupported key algorithm: %s", algorithm)
+}
+
+// keyAlgorithmOf returns the key algorithm of a public key
+func keyAlgorithmOf(publicKey crypto.PublicKey) (KeyAlgorithm, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		switch key.N.BitLen() {
+		case 2048:
+			return RSA2048, nil
+		case 3072:
+			return RSA3072, nil
+		case 4096:
+			return RSA4096, nil
+		}
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return ECDSAP256, nil
+		case elliptic.P384():
+			return ECDSAP384, nil
+		}
+	case ed25519.PublicKey:
+		return Ed25519, nil
+	}
+
+	return "", fmt.Errorf("keyAlgorithmOf: unsupported public key %T", publicKey)
+}
+
+// encodeKey returns the PKCS#8 PEM block of a private key
+func encodeKey(key crypto.Signer) (*pem.Block, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("encodeKey: unable to marshal key: %w", err)
+	}
+
+	return &pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: der,
+	}, nil
+}
+
+// parseKey returns the private key of a PKCS#8, PKCS#1 or SEC 1 PEM block
+func parseKey(block *pem.Block) (key crypto.Signer, err error) {
+	var parsed interface{}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("parseKey: unsupported PEM block type: %s", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parseKey: unable to parse key: %w", err)
+	}
+
+	key, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("parseKey: unsupported key %T", parsed)
+	}
+
+	return key, nil
+}
+
+// keyMatches reports whether the public key belongs to the private key
+func keyMatches(key crypto.Signer, publicKey crypto.PublicKey) bool {
+	public, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && public.Equal(publicKey)
+}
+
+// serialLimit bounds serial numbers to 128 bits
+var serialLimit = new(big.Int).Lsh(big.NewInt(1), 128)
+
+// randomSerial returns a random positive 128-bit serial number
+func randomSerial() (*big.Int, error) {
+	serial, err := cryptorand.Int(cryptorand.Reader, serialLimit)
+	if err != nil {
+		return nil, fmt.Errorf("randomSerial: unable to generate serial number: %w", err)
+	}
+
+	// serial numbers must be positive
+	return serial.Add(serial, big.NewInt(1)), nil
+}
+
+// keyIdentifier returns the SHA-1 hash of the subject public key, as in
+// method 1 of RFC 5280 section 4.2.1.2
+func keyIdentifier(publicKey crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("keyIdentifier: unable to marshal public key: %w", err)
+	}
+
+	var info struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err = asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("keyIdentifier: unable to parse public key: %w", err)
+	}
+
+	id := sha1.Sum(info.PublicKey.Bytes)
+	return id[:], nil
+}
@@ -0,0 +1,60 @@
+package certificates
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKeyAlgorithm(t *testing.T) {
+	for _, algorithm := range KeyAlgorithms {
+		got, err := ParseKeyAlgorithm(string(algorithm))
+		assert.NoError(t, err)
+		assert.Equal(t, algorithm, got)
+	}
+
+	got, err := ParseKeyAlgorithm("ECDSA-P256")
+	assert.NoError(t, err)
+	assert.Equal(t, ECDSAP256, got)
+
+	_, err = ParseKeyAlgorithm("dsa")
+	assert.Error(t, err)
+}
+
+func TestEncodeKey(t *testing.T) {
+	for _, algorithm := range []KeyAlgorithm{RSA2048, ECDSAP256, ECDSAP384, Ed25519} {
+		key, err := generateKey(algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		block, err := encodeKey(key)
+		assert.NoError(t, err)
+		assert.Equal(t, "PRIVATE KEY", block.Type)
+
+		parsed, err := parseKey(block)
+		assert.NoError(t, err)
+		assert.True(t, keyMatches(parsed, key.Public()), algorithm)
+
+		got, err := keyAlgorithmOf(parsed.Public())
+		assert.NoError(t, err)
+		assert.Equal(t, algorithm, got)
+	}
+}
+
+func TestParseKeyPKCS1(t *testing.T) {
+	key, err := generateKey(RSA2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := parseKey(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key.(*rsa.PrivateKey)),
+	})
+	assert.NoError(t, err)
+	assert.True(t, keyMatches(parsed, key.Public()))
+}
@@ -0,0 +1,91 @@
+package certificates
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/mikelorant/muting/pkg/watcher"
+)
+
+// reloadDelay lets both files of a key pair be written before reloading
+const reloadDelay = 500 * time.Millisecond
+
+// KeyPairReloader serves a certificate key pair loaded from files, loading
+// it again when the files change
+type KeyPairReloader struct {
+	certFile string
+	keyFile  string
+
+	mu          sync.RWMutex
+	certificate *tls.Certificate
+}
+
+func NewKeyPairReloader(certFile string, keyFile string) (reloader *KeyPairReloader, err error) {
+	reloader = &KeyPairReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if err = reloader.Reload(); err != nil {
+		return nil, fmt.Errorf("NewKeyPairReloader: %w", err)
+	}
+
+	return reloader, nil
+}
+
+// Reload loads the key pair from its files, keeping the current key pair
+// when they cannot be loaded
+func (r *KeyPairReloader) Reload() (err error) {
+	certificate, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("Reload: unable to load key pair: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.certificate = &certificate
+
+	return nil
+}
+
+// GetCertificate returns the current key pair, for use as the
+// GetCertificate callback of a tls.Config
+func (r *KeyPairReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.certificate, nil
+}
+
+// Watch reloads the key pair each time its files change until stop is closed
+func (r *KeyPairReloader) Watch(stop <-chan struct{}) (err error) {
+	var mu sync.Mutex
+	var timer *time.Timer
+
+	reload := func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if timer != nil {
+			timer.Stop()
+		}
+		timer = time.AfterFunc(reloadDelay, func() {
+			if err := r.Reload(); err != nil {
+				log.WithError(err).Error("Keeping current certificate")
+				return
+			}
+			log.Info("Reloaded certificate")
+		})
+	}
+
+	for _, file := range []string{r.certFile, r.keyFile} {
+		if err = watcher.Watch(file, reload, stop); err != nil {
+			return fmt.Errorf("Watch: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package certificates
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyPairReloader(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCertificates(t, dir, 24*time.Hour, time.Hour)
+
+	reloader, err := NewKeyPairReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	if err := reloader.Watch(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	certificate, err := reloader.GetCertificate(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, parseCertificatePEM(t, readTestFile(t, dir, "tls.crt")).Raw, certificate.Certificate[0])
+
+	// the rewritten key pair is served once it is reloaded
+	writeTestCertificates(t, dir, 24*time.Hour, time.Hour)
+	rewritten := parseCertificatePEM(t, readTestFile(t, dir, "tls.crt")).Raw
+	assert.Eventually(t, func() bool {
+		certificate, err := reloader.GetCertificate(nil)
+		return err == nil && bytes.Equal(rewritten, certificate.Certificate[0])
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestKeyPairReloaderInvalid(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCertificates(t, dir, 24*time.Hour, time.Hour)
+
+	reloader, err := NewKeyPairReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, _ := reloader.GetCertificate(nil)
+
+	// a key pair that cannot be loaded leaves the current one served
+	if err := writeFile(filepath.Join(dir, "tls.key"), []byte("invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	assert.Error(t, reloader.Reload())
+	current, _ := reloader.GetCertificate(nil)
+	assert.Equal(t, certificate, current)
+
+	_, err = NewKeyPairReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"))
+	assert.Error(t, err)
+}
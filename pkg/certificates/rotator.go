@@ -0,0 +1,172 @@
+package certificates
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// retryInterval is the least time between rotations, and how long a failed
+// rotation waits before trying again
+const retryInterval = time.Minute
+
+// Rotator renews the certificates WriteCertificates wrote to a directory
+// before the server certificate expires
+type Rotator struct {
+	// Dir is the directory of the certificates
+	Dir string
+	// RenewBefore is how long before the server certificate expires it is
+	// renewed
+	RenewBefore time.Duration
+	// Publish is given the PEM of a new CA certificate before the
+	// certificates it signs are written, so the new server certificate is
+	// trusted as soon as it is served
+	Publish func(caCert []byte) error
+	// Store is given the renewed certificates before they are written, to
+	// keep them wherever else they are stored
+	Store func(caConfig *CAConfig, serverConfig *ServerConfig) error
+}
+
+// Start renews the certificates each time they are due until stop is
+// closed. It returns an error when the certificates would be due again as
+// soon as they are renewed.
+func (r *Rotator) Start(stop <-chan struct{}) error {
+	for _, file := range []string{"tls.crt", "ca.crt"} {
+		certificate, err := readCertificate(filepath.Join(r.Dir, file))
+		if err != nil {
+			return fmt.Errorf("Start: %w", err)
+		}
+		if validity := certificate.NotAfter.Sub(certificate.NotBefore); r.RenewBefore >= validity {
+			return fmt.Errorf("Start: renewing %s before it expires is not less than its validity of %s", r.RenewBefore, validity)
+		}
+	}
+
+	go r.run(stop)
+
+	return nil
+}
+
+// run renews the certificates each time they are due, waiting at least the
+// retry interval between rotations
+func (r *Rotator) run(stop <-chan struct{}) {
+	for {
+		renewAt, err := r.renewAt()
+		if err == nil && !time.Now().Before(renewAt) {
+			if err = r.Rotate(); err == nil {
+				log.Info("Rotated certificates")
+				renewAt, err = r.renewAt()
+			}
+		}
+
+		wait := retryInterval
+		if err != nil {
+			log.WithError(err).Error("Failed to rotate certificates")
+		} else if until := time.Until(renewAt); until > wait {
+			wait = until
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Rotate issues a server certificate for the names and key algorithm of the
+// current one, signed by the current CA and writes them both. A new CA is
+// issued, valid for as long as the current one was, when the current one
+// cannot be loaded or would expire before the renewed server certificate is
+// due again, and is published before it is written.
+func (r *Rotator) Rotate() (err error) {
+	current, err := readCertificate(filepath.Join(r.Dir, "tls.crt"))
+	if err != nil {
+		return fmt.Errorf("Rotate: %w", err)
+	}
+
+	algorithm, err := keyAlgorithmOf(current.PublicKey)
+	if err != nil {
+		return fmt.Errorf("Rotate: %w", err)
+	}
+
+	currentCA, err := readCertificate(filepath.Join(r.Dir, "ca.crt"))
+	if err != nil {
+		return fmt.Errorf("Rotate: %w", err)
+	}
+	caValidity := currentCA.NotAfter.Sub(currentCA.NotBefore)
+
+	// a server certificate cut short by its CA expiring is renewed for as
+	// long as the CA was valid
+	validity := current.NotAfter.Sub(current.NotBefore)
+	if !current.NotAfter.Before(currentCA.NotAfter) {
+		validity = caValidity
+	}
+
+	caConfig, err := r.loadCA()
+	renewCA := err != nil || !caConfig.ValidFor(2*r.RenewBefore)
+	if err != nil {
+		log.WithError(err).Warn("Unable to load CA, issuing a new CA")
+	}
+	if renewCA {
+		if caConfig, err = NewCACertificate(algorithm, caValidity); err != nil {
+			return fmt.Errorf("Rotate: %w", err)
+		}
+	}
+
+	serverConfig, err := NewServerCertificate(&caConfig, current.Subject.CommonName, current.DNSNames, algorithm, validity)
+	if err != nil {
+		return fmt.Errorf("Rotate: %w", err)
+	}
+
+	if renewCA && r.Publish != nil {
+		if err = r.Publish(caConfig.GetCertificatePEM().Bytes()); err != nil {
+			return fmt.Errorf("Rotate: unable to publish CA certificate: %w", err)
+		}
+	}
+
+	if r.Store != nil {
+		if err = r.Store(&caConfig, &serverConfig); err != nil {
+			return fmt.Errorf("Rotate: unable to store certificates: %w", err)
+		}
+	}
+
+	if err = WriteCertificates(r.Dir, &caConfig, &serverConfig); err != nil {
+		return fmt.Errorf("Rotate: %w", err)
+	}
+
+	return nil
+}
+
+// loadCA loads the CA WriteCertificates wrote to the directory
+func (r *Rotator) loadCA() (caConfig CAConfig, err error) {
+	certPEM, err := ioutil.ReadFile(filepath.Join(r.Dir, "ca.crt"))
+	if err != nil {
+		return caConfig, fmt.Errorf("loadCA: unable to read CA certificate: %w", err)
+	}
+
+	keyPEM, err := ioutil.ReadFile(filepath.Join(r.Dir, "ca.key"))
+	if err != nil {
+		return caConfig, fmt.Errorf("loadCA: unable to read CA key: %w", err)
+	}
+
+	if caConfig, err = LoadCA(certPEM, keyPEM); err != nil {
+		return caConfig, fmt.Errorf("loadCA: %w", err)
+	}
+
+	return caConfig, nil
+}
+
+// renewAt returns when the current server certificate is due for renewal
+func (r *Rotator) renewAt() (time.Time, error) {
+	current, err := readCertificate(filepath.Join(r.Dir, "tls.crt"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("renewAt: %w", err)
+	}
+
+	return current.NotAfter.Add(-r.RenewBefore), nil
+}
@@ -0,0 +1,116 @@
+package certificates
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotate(t *testing.T) {
+	tc := []struct {
+		name        string
+		caValidity  time.Duration
+		validity    time.Duration
+		renewBefore time.Duration
+		renewCA     bool
+	}{
+		{
+			name:        "server certificate",
+			caValidity:  24 * time.Hour,
+			validity:    time.Hour,
+			renewBefore: 30 * time.Minute,
+		},
+		{
+			name:        "expiring CA",
+			caValidity:  time.Hour,
+			validity:    time.Hour,
+			renewBefore: 30 * time.Minute,
+			renewCA:     true,
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			caConfig := writeTestCertificates(t, dir, test.caValidity, test.validity)
+
+			var published []byte
+			var stored *CAConfig
+			rotator := &Rotator{
+				Dir:         dir,
+				RenewBefore: test.renewBefore,
+				Publish: func(caCert []byte) error {
+					published = caCert
+					return nil
+				},
+				Store: func(caConfig *CAConfig, serverConfig *ServerConfig) error {
+					stored = caConfig
+					return nil
+				},
+			}
+			if !assert.NoError(t, rotator.Rotate()) {
+				return
+			}
+
+			caCert := readTestFile(t, dir, "ca.crt")
+			if test.renewCA {
+				assert.NotEqual(t, caConfig.GetCertificatePEM().Bytes(), caCert)
+				assert.Equal(t, caCert, published)
+			} else {
+				assert.Equal(t, caConfig.GetCertificatePEM().Bytes(), caCert)
+				assert.Nil(t, published, "an unchanged CA is not published")
+			}
+			if assert.NotNil(t, stored) {
+				assert.Equal(t, caCert, stored.GetCertificatePEM().Bytes())
+			}
+
+			ca := parseCertificatePEM(t, caCert)
+			server := parseCertificatePEM(t, readTestFile(t, dir, "tls.crt"))
+			assert.NoError(t, server.CheckSignatureFrom(ca))
+			assert.Equal(t, "muting.default.svc", server.Subject.CommonName)
+			assert.Equal(t, []string{"muting", "muting.default.svc"}, server.DNSNames)
+
+			for file, mode := range map[string]os.FileMode{"ca.crt": 0o644, "ca.key": 0o600, "tls.crt": 0o644, "tls.key": 0o600} {
+				info, err := os.Stat(filepath.Join(dir, file))
+				if assert.NoError(t, err) {
+					assert.Equal(t, mode, info.Mode().Perm(), file)
+				}
+			}
+		})
+	}
+}
+
+func TestRotateWithoutCAKey(t *testing.T) {
+	dir := t.TempDir()
+	caConfig := writeTestCertificates(t, dir, 24*time.Hour, time.Hour)
+	if err := os.Remove(filepath.Join(dir, "ca.key")); err != nil {
+		t.Fatal(err)
+	}
+
+	// a CA that cannot be loaded is replaced
+	rotator := &Rotator{Dir: dir, RenewBefore: 30 * time.Minute}
+	assert.NoError(t, rotator.Rotate())
+	assert.NotEqual(t, caConfig.GetCertificatePEM().Bytes(), readTestFile(t, dir, "ca.crt"))
+	assert.FileExists(t, filepath.Join(dir, "ca.key"))
+}
+
+func TestRotatorStart(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCertificates(t, dir, 24*time.Hour, time.Hour)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	// renewing as soon as the certificates are issued would never stop
+	rotator := &Rotator{Dir: dir, RenewBefore: time.Hour}
+	assert.Error(t, rotator.Start(stop))
+
+	rotator = &Rotator{Dir: dir, RenewBefore: 30 * time.Minute}
+	assert.NoError(t, rotator.Start(stop))
+
+	rotator = &Rotator{Dir: t.TempDir(), RenewBefore: 30 * time.Minute}
+	assert.Error(t, rotator.Start(stop))
+}
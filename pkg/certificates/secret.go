@@ -0,0 +1,85 @@
+package certificates
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// CACertKey is the key of the CA certificate in a secret
+	CACertKey = "ca.crt"
+	// CAKeyKey is the key of the CA key in a secret
+	CAKeyKey = "ca.key"
+)
+
+// ReadSecretCA loads the CA stored in a secret by WriteSecret. It reports
+// false when there is no secret or it holds no CA, and returns an error when
+// the CA it holds cannot be loaded.
+func ReadSecretCA(client kubernetes.Interface, namespace string, name string) (ca CAConfig, ok bool, err error) {
+	secret, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil && apierrors.IsNotFound(err) {
+		return ca, false, nil
+	} else if err != nil {
+		return ca, false, fmt.Errorf("ReadSecretCA: unable to get secret: %w", err)
+	}
+
+	if len(secret.Data[CACertKey]) == 0 && len(secret.Data[CAKeyKey]) == 0 {
+		return ca, false, nil
+	}
+
+	if ca, err = LoadCA(secret.Data[CACertKey], secret.Data[CAKeyKey]); err != nil {
+		return ca, false, fmt.Errorf("ReadSecretCA: unable to load CA of secret %s/%s: %w", namespace, name, err)
+	}
+
+	return ca, true, nil
+}
+
+// WriteSecret creates or updates a kubernetes.io/tls secret holding the
+// server certificate and key along with the CA certificate and, unless it is
+// excluded, the CA key
+func WriteSecret(client kubernetes.Interface, namespace string, name string, caConfig *CAConfig, serverConfig *ServerConfig) (err error) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       serverConfig.certificatePEM.Bytes(),
+			corev1.TLSPrivateKeyKey: serverConfig.keyPEM.Bytes(),
+			CACertKey:               caConfig.certificatePEM.Bytes(),
+			CAKeyKey:                caConfig.keyPEM.Bytes(),
+		},
+	}
+	if caConfig.excludeKey {
+		delete(secret.Data, CAKeyKey)
+	}
+
+	existing, err := client.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil && apierrors.IsNotFound(err) {
+		if _, err = client.CoreV1().Secrets(namespace).Create(context.TODO(), secret, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("WriteSecret: unable to create secret: %w", err)
+		}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("WriteSecret: unable to get secret: %w", err)
+	}
+
+	if existing.Type != corev1.SecretTypeTLS {
+		return fmt.Errorf("WriteSecret: secret %s/%s is of type %s", namespace, name, existing.Type)
+	}
+
+	secret.ObjectMeta.ResourceVersion = existing.ObjectMeta.ResourceVersion
+	secret.ObjectMeta.Labels = existing.ObjectMeta.Labels
+	secret.ObjectMeta.Annotations = existing.ObjectMeta.Annotations
+	if _, err = client.CoreV1().Secrets(namespace).Update(context.TODO(), secret, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("WriteSecret: unable to update secret: %w", err)
+	}
+
+	return nil
+}
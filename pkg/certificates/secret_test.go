@@ -0,0 +1,158 @@
+package certificates
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWriteSecret(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	caConfig, serverConfig := newTestCertificates(t, time.Hour, time.Hour)
+
+	// created
+	assert.NoError(t, WriteSecret(client, "default", "muting-tls", &caConfig, &serverConfig))
+	secret := getTestSecret(t, client)
+	assert.Equal(t, corev1.SecretTypeTLS, secret.Type)
+	assert.Equal(t, map[string][]byte{
+		corev1.TLSCertKey:       serverConfig.certificatePEM.Bytes(),
+		corev1.TLSPrivateKeyKey: serverConfig.keyPEM.Bytes(),
+		CACertKey:               caConfig.certificatePEM.Bytes(),
+		CAKeyKey:                caConfig.keyPEM.Bytes(),
+	}, secret.Data)
+
+	// updated, keeping its labels
+	secret.Labels = map[string]string{"app": "muting"}
+	if _, err := client.CoreV1().Secrets("default").Update(context.TODO(), secret, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	renewed, err := NewServerCertificate(&caConfig, "muting.default.svc", []string{"muting.default.svc"}, ECDSAP256, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, WriteSecret(client, "default", "muting-tls", &caConfig, &renewed))
+	secret = getTestSecret(t, client)
+	assert.Equal(t, renewed.certificatePEM.Bytes(), secret.Data[corev1.TLSCertKey])
+	assert.Equal(t, map[string]string{"app": "muting"}, secret.Labels)
+}
+
+func TestWriteSecretExcludedKey(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	caConfig, serverConfig := newTestCertificates(t, time.Hour, time.Hour)
+	caConfig.ExcludeKey()
+
+	assert.NoError(t, WriteSecret(client, "default", "muting-tls", &caConfig, &serverConfig))
+	secret := getTestSecret(t, client)
+	assert.Equal(t, caConfig.certificatePEM.Bytes(), secret.Data[CACertKey])
+	assert.NotContains(t, secret.Data, CAKeyKey)
+}
+
+func TestWriteSecretType(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "muting-tls"},
+		Type:       corev1.SecretTypeOpaque,
+	})
+	caConfig, serverConfig := newTestCertificates(t, time.Hour, time.Hour)
+
+	assert.Error(t, WriteSecret(client, "default", "muting-tls", &caConfig, &serverConfig))
+}
+
+func TestReadSecretCA(t *testing.T) {
+	caConfig, serverConfig := newTestCertificates(t, time.Hour, time.Hour)
+
+	tc := []struct {
+		name   string
+		secret *corev1.Secret
+		ok     bool
+		err    bool
+	}{
+		{
+			name: "missing",
+		},
+		{
+			name: "valid",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "muting-tls"},
+				Data: map[string][]byte{
+					CACertKey: caConfig.certificatePEM.Bytes(),
+					CAKeyKey:  caConfig.keyPEM.Bytes(),
+				},
+			},
+			ok: true,
+		},
+		{
+			name: "without CA",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "muting-tls"},
+				Data: map[string][]byte{
+					corev1.TLSCertKey:       serverConfig.certificatePEM.Bytes(),
+					corev1.TLSPrivateKeyKey: serverConfig.keyPEM.Bytes(),
+				},
+			},
+		},
+		{
+			name: "mismatched key",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "muting-tls"},
+				Data: map[string][]byte{
+					CACertKey: caConfig.certificatePEM.Bytes(),
+					CAKeyKey:  serverConfig.keyPEM.Bytes(),
+				},
+			},
+			err: true,
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			if test.secret != nil {
+				client = fake.NewSimpleClientset(test.secret)
+			}
+
+			ca, ok, err := ReadSecretCA(client, "default", "muting-tls")
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.ok, ok)
+			if test.ok {
+				assert.Equal(t, caConfig.certificatePEM.Bytes(), ca.GetCertificatePEM().Bytes())
+				assert.True(t, ca.ValidFor(time.Minute))
+			}
+		})
+	}
+}
+
+func TestReadSecretCARoundTrip(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	caConfig, serverConfig := newTestCertificates(t, time.Hour, time.Hour)
+
+	if err := WriteSecret(client, "default", "muting-tls", &caConfig, &serverConfig); err != nil {
+		t.Fatal(err)
+	}
+	ca, ok, err := ReadSecretCA(client, "default", "muting-tls")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, caConfig.keyPEM.Bytes(), ca.GetKeyPEM().Bytes())
+
+	// the CA is only reused while it is valid for long enough
+	assert.True(t, ca.ValidFor(30*time.Minute))
+	assert.False(t, ca.ValidFor(2*time.Hour))
+}
+
+func getTestSecret(t *testing.T, client *fake.Clientset) *corev1.Secret {
+	t.Helper()
+
+	secret, err := client.CoreV1().Secrets("default").Get(context.TODO(), "muting-tls", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
@@ -2,12 +2,11 @@ package certificates
 
 import (
 	"bytes"
+	"crypto"
 	cryptorand "crypto/rand"
-	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
-	"math/big"
 	"time"
 	"fmt"
 )
@@ -18,17 +17,25 @@ type ServerConfig struct {
 	dnsNames       []string
 	certificate    *x509.Certificate
 	certificatePEM bytes.Buffer
-	key            *rsa.PrivateKey
+	key            crypto.Signer
 	keyPEM         bytes.Buffer
+	validity       time.Duration
 }
 
-func NewServerCertificate(caConfig *CAConfig, commonName string, dnsNames []string) (server ServerConfig, err error) {
+// NewServerCertificate generates a server certificate signed by the CA with a
+// key of the algorithm, valid for the validity period or until the CA expires
+func NewServerCertificate(caConfig *CAConfig, commonName string, dnsNames []string, algorithm KeyAlgorithm, validity time.Duration) (server ServerConfig, err error) {
+	if validity <= 0 {
+		return server, fmt.Errorf("NewServerCertificate: invalid validity period: %s", validity)
+	}
+
 	server = ServerConfig{
 		caConfig:   caConfig,
 		commonName: commonName,
 		dnsNames:   dnsNames,
+		validity:   validity,
 	}
-	if err = server.genKey(); err != nil {
+	if err = server.genKey(algorithm); err != nil {
 		return server, fmt.Errorf("NewServerCertificate: genKey failed: %w", err)
 	}
 
@@ -36,7 +43,9 @@ func NewServerCertificate(caConfig *CAConfig, commonName string, dnsNames []stri
 		return server, fmt.Errorf("NewServerCertificate: genKeyPEM failed: %w", err)
 	}
 
-	server.genCertificate()
+	if err = server.genCertificate(); err != nil {
+		return server, fmt.Errorf("NewServerCertificate: genCertificate failed: %w", err)
+	}
 
 	if err = server.genCertificatePEM(); err != nil {
 		return server, fmt.Errorf("NewServerCertificate: genCertificatePEM failed: %w", err)
@@ -45,8 +54,8 @@ func NewServerCertificate(caConfig *CAConfig, commonName string, dnsNames []stri
 	return server, err
 }
 
-func (s *ServerConfig) genKey() (err error) {
-	s.key, err = rsa.GenerateKey(cryptorand.Reader, 4096)
+func (s *ServerConfig) genKey(algorithm KeyAlgorithm) (err error) {
+	s.key, err = generateKey(algorithm)
 	if err != nil {
 		return fmt.Errorf("genKey: unable to generate key: %w", err)
 	}
@@ -55,10 +64,12 @@ func (s *ServerConfig) genKey() (err error) {
 }
 
 func (s *ServerConfig) genKeyPEM() (err error) {
-	err = pem.Encode(&s.keyPEM, &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(s.key),
-	})
+	block, err := encodeKey(s.key)
+	if err != nil {
+		return fmt.Errorf("genKeyPEM: %w", err)
+	}
+
+	err = pem.Encode(&s.keyPEM, block)
 	if err != nil {
 		return fmt.Errorf("genKeyPEM: unable to create key PEM: %w", err)
 	}
@@ -66,29 +77,48 @@ func (s *ServerConfig) genKeyPEM() (err error) {
 	return err
 }
 
-func (s *ServerConfig) genCertificate() {
+func (s *ServerConfig) genCertificate() (err error) {
+	serial, err := randomSerial()
+	if err != nil {
+		return fmt.Errorf("genCertificate: %w", err)
+	}
+
+	keyID, err := keyIdentifier(s.key.Public())
+	if err != nil {
+		return fmt.Errorf("genCertificate: %w", err)
+	}
+
+	// a certificate is only trusted while its CA is valid
+	notAfter := time.Now().Add(s.validity)
+	if notAfter.After(s.caConfig.certificate.NotAfter) {
+		notAfter = s.caConfig.certificate.NotAfter
+	}
+
 	s.certificate = &x509.Certificate{
 		DNSNames:       s.dnsNames,
-		SerialNumber:   big.NewInt(1658),
+		SerialNumber:   serial,
 		Subject:        pkix.Name{
 			CommonName:   s.commonName,
 			Organization: []string{"muting.io"},
 		},
 		NotBefore:      time.Now(),
-		NotAfter:       time.Now().AddDate(1, 0, 0),
-		SubjectKeyId:   []byte{1, 2, 3, 4, 6},
+		NotAfter:       notAfter,
+		SubjectKeyId:   keyID,
+		AuthorityKeyId: s.caConfig.certificate.SubjectKeyId,
 		ExtKeyUsage:    []x509.ExtKeyUsage{
 			x509.ExtKeyUsageClientAuth,
 			x509.ExtKeyUsageServerAuth,
 		},
 		KeyUsage:       x509.KeyUsageDigitalSignature,
 	}
+
+	return err
 }
 
 func (s *ServerConfig) genCertificatePEM() (err error) {
 	var cert []byte
 
-	cert, err = x509.CreateCertificate(cryptorand.Reader, s.certificate, s.caConfig.certificate, &s.key.PublicKey, s.caConfig.key)
+	cert, err = x509.CreateCertificate(cryptorand.Reader, s.certificate, s.caConfig.certificate, s.key.Public(), s.caConfig.key)
 	if err != nil {
 		return fmt.Errorf("genCertificatePEM: unable to create certificate PEM: %w", err)
 	}
@@ -101,5 +131,10 @@ func (s *ServerConfig) genCertificatePEM() (err error) {
 		return fmt.Errorf("genCertificatePEM: unable to PEM encode certificate: %w", err)
 	}
 
+	// clients trusting only the root need the chain of an intermediate CA
+	if s.caConfig.intermediate() {
+		s.certificatePEM.Write(s.caConfig.certificatePEM.Bytes())
+	}
+
 	return err
 }
@@ -0,0 +1,78 @@
+package certificates
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewServerCertificate(t *testing.T) {
+	ca, err := NewCACertificate(ECDSAP256, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tc := []struct {
+		name      string
+		algorithm KeyAlgorithm
+	}{
+		{name: "rsa", algorithm: RSA2048},
+		{name: "ecdsa", algorithm: ECDSAP384},
+		{name: "ed25519", algorithm: Ed25519},
+	}
+
+	for _, tt := range tc {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := NewServerCertificate(&ca, "muting.default.svc", []string{"muting", "muting.default"}, tt.algorithm, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cert := parseCertificatePEM(t, server.certificatePEM.Bytes())
+			caCert := parseCertificatePEM(t, ca.GetCertificatePEM().Bytes())
+
+			assert.False(t, cert.IsCA)
+			assert.Equal(t, "muting.default.svc", cert.Subject.CommonName)
+			assert.Equal(t, []string{"muting", "muting.default"}, cert.DNSNames)
+			assert.Equal(t, 1, cert.SerialNumber.Sign())
+			assert.LessOrEqual(t, cert.SerialNumber.BitLen(), 129)
+			assert.NotEqual(t, caCert.SerialNumber, cert.SerialNumber)
+
+			keyID, err := keyIdentifier(cert.PublicKey)
+			assert.NoError(t, err)
+			assert.Equal(t, keyID, cert.SubjectKeyId)
+			assert.Equal(t, caCert.SubjectKeyId, cert.AuthorityKeyId)
+
+			assert.WithinDuration(t, cert.NotBefore.Add(time.Hour), cert.NotAfter, time.Second)
+
+			roots := x509.NewCertPool()
+			roots.AddCert(caCert)
+			_, err = cert.Verify(x509.VerifyOptions{
+				DNSName:   "muting.default",
+				Roots:     roots,
+				KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			})
+			assert.NoError(t, err)
+
+			_, err = tls.X509KeyPair(server.certificatePEM.Bytes(), server.keyPEM.Bytes())
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestNewServerCertificateCAExpiry(t *testing.T) {
+	ca, err := NewCACertificate(ECDSAP256, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := NewServerCertificate(&ca, "muting", []string{"muting"}, ECDSAP256, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the server certificate expires with its CA
+	assert.Equal(t, ca.certificate.NotAfter, server.certificate.NotAfter)
+}
@@ -1,9 +1,12 @@
 package certificates
 
 import (
+	"crypto/x509"
+	"encoding/pem"
 	"io/ioutil"
 	"os"
 	"fmt"
+	"path"
 )
 
 func WriteCertificates(filepath string, caConfig *CAConfig, serverConfig *ServerConfig) (err error) {
@@ -11,17 +14,70 @@ func WriteCertificates(filepath string, caConfig *CAConfig, serverConfig *Server
 		return fmt.Errorf("WriteCertificates: unable to create certificates directory: %w", err)
 	}
 
-	if err = ioutil.WriteFile(filepath+"/ca.crt", caConfig.certificatePEM.Bytes(), 0o644); err != nil {
+	if err = writeFile(filepath+"/ca.crt", caConfig.certificatePEM.Bytes(), 0o644); err != nil {
 		return fmt.Errorf("WriteCertificates: unable to create CA certificate PEM file: %w", err)
 	}
 
-	if err = ioutil.WriteFile(filepath+"/tls.crt", serverConfig.certificatePEM.Bytes(), 0o644); err != nil {
+	// the CA key lets the server certificate be renewed under the same CA,
+	// unless it is kept elsewhere
+	if caConfig.excludeKey {
+		if err = os.Remove(filepath+"/ca.key"); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("WriteCertificates: unable to remove CA key PEM file: %w", err)
+		}
+	} else if err = writeFile(filepath+"/ca.key", caConfig.keyPEM.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("WriteCertificates: unable to create CA key PEM file: %w", err)
+	}
+
+	if err = writeFile(filepath+"/tls.crt", serverConfig.certificatePEM.Bytes(), 0o644); err != nil {
 		return fmt.Errorf("WriteCertificates: unable to create server certificate PEM file: %w", err)
 	}
 
-	if err = ioutil.WriteFile(filepath+"/tls.key", serverConfig.keyPEM.Bytes(), 0o644); err != nil {
+	if err = writeFile(filepath+"/tls.key", serverConfig.keyPEM.Bytes(), 0o600); err != nil {
 		return fmt.Errorf("WriteCertificates: unable to create server key PEM file: %w", err)
 	}
 
 	return err
 }
+
+// writeFile replaces the file by renaming a temporary file over it, so
+// readers never see a partly written file
+func writeFile(filename string, data []byte, perm os.FileMode) (err error) {
+	tmp, err := ioutil.TempFile(path.Dir(filename), "."+path.Base(filename))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+// readCertificate reads the first certificate of a PEM file
+func readCertificate(filename string) (certificate *x509.Certificate, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("readCertificate: unable to read certificate PEM file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("readCertificate: no certificate in %s", filename)
+	}
+
+	certificate, err = x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("readCertificate: unable to parse certificate: %w", err)
+	}
+
+	return certificate, nil
+}
@@ -0,0 +1,46 @@
+package certificates
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteCertificatesExcludedKey(t *testing.T) {
+	dir := t.TempDir()
+	writeTestCertificates(t, dir, 24*time.Hour, time.Hour)
+	assert.FileExists(t, filepath.Join(dir, "ca.key"))
+
+	// the key of a CA kept elsewhere is not written, nor left behind
+	caConfig, serverConfig := newTestCertificates(t, time.Hour, time.Hour)
+	caConfig.ExcludeKey()
+	assert.NoError(t, WriteCertificates(dir, &caConfig, &serverConfig))
+	assert.NoFileExists(t, filepath.Join(dir, "ca.key"))
+	assert.Equal(t, caConfig.GetCertificatePEM().Bytes(), readTestFile(t, dir, "ca.crt"))
+	assert.FileExists(t, filepath.Join(dir, "tls.key"))
+}
+
+// writeTestCertificates writes certificates valid for the validity periods
+// to the directory and returns their CA
+func writeTestCertificates(t *testing.T, dir string, caValidity time.Duration, validity time.Duration) CAConfig {
+	t.Helper()
+
+	caConfig, serverConfig := newTestCertificates(t, caValidity, validity)
+	if err := WriteCertificates(dir, &caConfig, &serverConfig); err != nil {
+		t.Fatal(err)
+	}
+	return caConfig
+}
+
+func readTestFile(t *testing.T, dir string, file string) []byte {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
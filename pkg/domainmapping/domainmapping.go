@@ -0,0 +1,229 @@
+package domainmapping
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/mikelorant/muting/pkg/apis/muting/v1alpha1"
+	"github.com/mikelorant/muting/pkg/mutator"
+)
+
+// Build returns the mapping of the domain mappings. Domain mappings apply to
+// their namespace ahead of cluster domain mappings, which still apply to the
+// hosts they leave. Cluster domain mappings selecting no namespaces apply to
+// every namespace no other cluster domain mapping selects, ahead of the rules
+// the mapping is combined with. Mappings are ordered by namespace and name,
+// the rules of the domain mappings of a namespace are combined. Invalid
+// mappings are left out and returned as errors.
+func Build(cluster []v1alpha1.ClusterDomainMapping, namespaced []v1alpha1.DomainMapping) (*mutator.Mapping, []error) {
+	var errs []error
+
+	sort.Slice(namespaced, func(i, j int) bool {
+		if namespaced[i].Namespace != namespaced[j].Namespace {
+			return namespaced[i].Namespace < namespaced[j].Namespace
+		}
+		return namespaced[i].Name < namespaced[j].Name
+	})
+	sort.Slice(cluster, func(i, j int) bool {
+		return cluster[i].Name < cluster[j].Name
+	})
+
+	var mappings []*mutator.Mapping
+	byNamespace := map[string]*mutator.NamespaceRule{}
+	for _, dm := range namespaced {
+		mapping := &mutator.Mapping{
+			Rules: []mutator.NamespaceRule{{
+				Name:        "domainmappings/" + dm.Namespace,
+				Namespaces:  []string{dm.Namespace},
+				Domains:     convertRules(dm.Spec.Domains),
+				Fallthrough: true,
+			}},
+		}
+		if err := mapping.Compile(); err != nil {
+			errs = append(errs, fmt.Errorf("DomainMapping %s/%s: %w", dm.Namespace, dm.Name, err))
+			continue
+		}
+
+		if rule, ok := byNamespace[dm.Namespace]; ok {
+			rule.Domains = append(rule.Domains, mapping.Rules[0].Domains...)
+			continue
+		}
+		mappings = append(mappings, mapping)
+		byNamespace[dm.Namespace] = &mapping.Rules[0]
+	}
+
+	// cluster domain mappings selecting every namespace follow the others,
+	// which take precedence over them
+	var everyNamespace []*mutator.Mapping
+	for _, cdm := range cluster {
+		rule := mutator.NamespaceRule{
+			Name:       "clusterdomainmappings/" + cdm.Name,
+			Namespaces: cdm.Spec.Namespaces,
+			Selector:   cdm.Spec.Selector,
+			Domains:    convertRules(cdm.Spec.Domains),
+		}
+		all := len(cdm.Spec.Namespaces) == 0 && cdm.Spec.Selector == nil
+		if all {
+			rule.Selector = &metav1.LabelSelector{}
+			rule.Fallthrough = true
+		}
+
+		mapping := &mutator.Mapping{Rules: []mutator.NamespaceRule{rule}}
+		if err := mapping.Compile(); err != nil {
+			errs = append(errs, fmt.Errorf("ClusterDomainMapping %s: %w", cdm.Name, err))
+			continue
+		}
+		if all {
+			everyNamespace = append(everyNamespace, mapping)
+			continue
+		}
+		mappings = append(mappings, mapping)
+	}
+	mappings = append(mappings, everyNamespace...)
+
+	return mutator.CombineMappings(mappings...), errs
+}
+
+// syncTimeout bounds how long Watch waits for the domain mappings to be
+// listed, as listing never succeeds when their CRDs are not installed
+var syncTimeout = 30 * time.Second
+
+// Watch keeps the mapping of the domain mappings up to date with informers.
+// It calls update with the mapping of all domain mappings once they are
+// listed, and again each time one changes, until stop is closed. It returns
+// an error when they cannot be listed within the sync timeout.
+func Watch(client dynamic.Interface, update func(*mutator.Mapping), stop <-chan struct{}) error {
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+	cluster := factory.ForResource(v1alpha1.ClusterDomainMappingResource)
+	namespaced := factory.ForResource(v1alpha1.DomainMappingResource)
+
+	var mu sync.Mutex
+	synced := false
+	rebuild := func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// the mappings are only complete once both informers are synced
+		if !synced {
+			return
+		}
+
+		clusterMappings, namespacedMappings, errs := list(cluster.Lister().List, namespaced.Lister().List)
+		mapping, buildErrs := Build(clusterMappings, namespacedMappings)
+		for _, err := range append(errs, buildErrs...) {
+			log.WithError(err).Error("Ignoring invalid domain mapping")
+		}
+		update(mapping)
+	}
+
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { rebuild() },
+		UpdateFunc: func(oldObj, newObj interface{}) { rebuild() },
+		DeleteFunc: func(obj interface{}) { rebuild() },
+	}
+	cluster.Informer().AddEventHandler(handler)
+	namespaced.Informer().AddEventHandler(handler)
+
+	// the informers stop with stop, or when the domain mappings cannot be
+	// listed in time
+	informerStop := make(chan struct{})
+	var stopOnce sync.Once
+	stopInformers := func() { stopOnce.Do(func() { close(informerStop) }) }
+	go func() {
+		select {
+		case <-stop:
+			stopInformers()
+		case <-informerStop:
+		}
+	}()
+
+	factory.Start(informerStop)
+	timeout := time.AfterFunc(syncTimeout, stopInformers)
+	results := factory.WaitForCacheSync(informerStop)
+	if !timeout.Stop() {
+		stopInformers()
+		return fmt.Errorf("Watch: unable to list domain mappings within %s, are the CRDs installed?", syncTimeout)
+	}
+	for resource, ok := range results {
+		if !ok {
+			stopInformers()
+			return fmt.Errorf("Watch: unable to list %s", resource.Resource)
+		}
+	}
+
+	mu.Lock()
+	synced = true
+	mu.Unlock()
+	rebuild()
+
+	return nil
+}
+
+// list converts the listed domain mappings to their types
+func list(listCluster, listNamespaced func(labels.Selector) ([]runtime.Object, error)) ([]v1alpha1.ClusterDomainMapping, []v1alpha1.DomainMapping, []error) {
+	var errs []error
+
+	var cluster []v1alpha1.ClusterDomainMapping
+	objects, err := listCluster(labels.Everything())
+	if err != nil {
+		errs = append(errs, fmt.Errorf("unable to list cluster domain mappings: %w", err))
+	}
+	for _, obj := range objects {
+		var cdm v1alpha1.ClusterDomainMapping
+		if err := fromUnstructured(obj, &cdm); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		cluster = append(cluster, cdm)
+	}
+
+	var namespaced []v1alpha1.DomainMapping
+	objects, err = listNamespaced(labels.Everything())
+	if err != nil {
+		errs = append(errs, fmt.Errorf("unable to list domain mappings: %w", err))
+	}
+	for _, obj := range objects {
+		var dm v1alpha1.DomainMapping
+		if err := fromUnstructured(obj, &dm); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		namespaced = append(namespaced, dm)
+	}
+
+	return cluster, namespaced, errs
+}
+
+func fromUnstructured(obj runtime.Object, out interface{}) error {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("unexpected object %T", obj)
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), out); err != nil {
+		return fmt.Errorf("unable to convert %s %s/%s: %w", u.GetKind(), u.GetNamespace(), u.GetName(), err)
+	}
+	return nil
+}
+
+func convertRules(domains []v1alpha1.DomainRule) []mutator.Rule {
+	rules := make([]mutator.Rule, 0, len(domains))
+	for _, domain := range domains {
+		rules = append(rules, mutator.Rule{
+			Mode:   mutator.RuleMode(domain.Mode),
+			Source: domain.Source,
+			Target: domain.Target,
+		})
+	}
+	return rules
+}
@@ -0,0 +1,285 @@
+package domainmapping
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/mikelorant/muting/pkg/apis/muting/v1alpha1"
+	"github.com/mikelorant/muting/pkg/mutator"
+)
+
+func TestBuild(t *testing.T) {
+	cluster := []v1alpha1.ClusterDomainMapping{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "preview"},
+			Spec: v1alpha1.ClusterDomainMappingSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"environment": "preview"}},
+				Domains:  []v1alpha1.DomainRule{{Source: "example.org", Target: "preview.example.com"}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "default"},
+			Spec: v1alpha1.ClusterDomainMappingSpec{
+				Domains: []v1alpha1.DomainRule{
+					{Source: "example.org", Target: "example.com"},
+					{Source: "example.io", Target: "example.com"},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "invalid"},
+			Spec: v1alpha1.ClusterDomainMappingSpec{
+				Domains: []v1alpha1.DomainRule{{Mode: "glob", Source: "example.org", Target: "example.com"}},
+			},
+		},
+	}
+	namespaced := []v1alpha1.DomainMapping{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "staging", Name: "b"},
+			Spec: v1alpha1.DomainMappingSpec{
+				Domains: []v1alpha1.DomainRule{{Source: "example.net", Target: "staging.example.com"}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "staging", Name: "a"},
+			Spec: v1alpha1.DomainMappingSpec{
+				Domains: []v1alpha1.DomainRule{{Source: "example.org", Target: "staging.example.com"}},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "empty"},
+		},
+	}
+
+	mapping, errs := Build(cluster, namespaced)
+	assert.Len(t, errs, 2)
+	assert.Equal(t, []string{
+		"domainmappings/staging: namespaces staging",
+		"domainmappings/staging: fallthrough",
+		"domainmappings/staging: suffix example.org=staging.example.com",
+		"domainmappings/staging: suffix example.net=staging.example.com",
+		"clusterdomainmappings/preview: selector environment=preview",
+		"clusterdomainmappings/preview: suffix example.org=preview.example.com",
+		"clusterdomainmappings/default: all namespaces",
+		"clusterdomainmappings/default: fallthrough",
+		"clusterdomainmappings/default: suffix example.org=example.com",
+		"clusterdomainmappings/default: suffix example.io=example.com",
+	}, mapping.Describe())
+
+	// namespaced mappings take precedence over cluster mappings, which
+	// still apply to the hosts namespaced mappings leave
+	preview := func(namespace string) (map[string]string, error) {
+		return map[string]string{"environment": "preview"}, nil
+	}
+	rules, err := mapping.Select("staging", preview)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"suffix example.org=staging.example.com",
+		"suffix example.net=staging.example.com",
+		"suffix example.org=preview.example.com",
+	}, describeRules(rules))
+
+	none := func(namespace string) (map[string]string, error) {
+		return map[string]string{}, nil
+	}
+	rules, err = mapping.Select("staging", none)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"suffix example.org=staging.example.com",
+		"suffix example.net=staging.example.com",
+		"suffix example.org=example.com",
+		"suffix example.io=example.com",
+	}, describeRules(rules))
+
+	rules, err = mapping.Select("pr-1", preview)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"suffix example.org=preview.example.com"}, describeRules(rules))
+}
+
+func TestBuildClusterFallback(t *testing.T) {
+	cluster := []v1alpha1.ClusterDomainMapping{{
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+		Spec: v1alpha1.ClusterDomainMappingSpec{
+			Domains: []v1alpha1.DomainRule{{Source: "example.io", Target: "example.com"}},
+		},
+	}}
+	namespaced := []v1alpha1.DomainMapping{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "staging", Name: "staging"},
+		Spec: v1alpha1.DomainMappingSpec{
+			Domains: []v1alpha1.DomainRule{{Source: "example.org", Target: "staging.example.com"}},
+		},
+	}}
+
+	mapping, errs := Build(cluster, namespaced)
+	assert.Empty(t, errs)
+
+	// a host only the cluster mapping covers is still rewritten
+	rules, err := mapping.Select("staging", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com", targetOf(rules, "app.example.io"))
+	assert.Equal(t, "staging.example.com", targetOf(rules, "app.example.org"))
+}
+
+// targetOf returns the target of the first rule covering the host
+func targetOf(rules []mutator.Rule, host string) string {
+	for _, rule := range rules {
+		if mutator.InDomain(host, rule.Source) {
+			return rule.Target
+		}
+	}
+	return ""
+}
+
+func TestBuildCombined(t *testing.T) {
+	cluster := []v1alpha1.ClusterDomainMapping{{
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+		Spec: v1alpha1.ClusterDomainMappingSpec{
+			Domains: []v1alpha1.DomainRule{{Source: "example.org", Target: "example.com"}},
+		},
+	}}
+	apiMapping, errs := Build(cluster, nil)
+	assert.Empty(t, errs)
+
+	// a mapping file selecting the namespace, as the server combines them
+	fileRules, err := mutator.ParseRules([]string{"example.org=staging.example.net", "example.io=staging.example.net"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultRules, err := mutator.ParseRules([]string{"example.org=example.net"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileMapping := &mutator.Mapping{
+		Default: defaultRules,
+		Rules: []mutator.NamespaceRule{{
+			Name:       "staging",
+			Namespaces: []string{"staging"},
+			Domains:    fileRules,
+		}},
+	}
+	if err := fileMapping.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	mapping := mutator.CombineMappings(apiMapping, fileMapping)
+	assert.False(t, mapping.SelectsLabels(), "selecting every namespace needs no labels")
+
+	// the cluster domain mapping takes precedence over the mapping file
+	// rule, which still applies to the hosts it leaves
+	rules, err := mapping.Select("staging", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com", targetOf(rules, "app.example.org"))
+	assert.Equal(t, "staging.example.net", targetOf(rules, "app.example.io"))
+
+	rules, err = mapping.Select("other", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"suffix example.org=example.com",
+		"suffix example.org=example.net",
+	}, describeRules(rules))
+}
+
+func describeRules(rules []mutator.Rule) []string {
+	lines := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		lines = append(lines, rule.String())
+	}
+	return lines
+}
+
+func TestWatch(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		v1alpha1.DomainMappingResource:        "DomainMappingList",
+		v1alpha1.ClusterDomainMappingResource: "ClusterDomainMappingList",
+	}, newObject("ClusterDomainMapping", "", "default", "example.org", "example.com"))
+
+	updates := make(chan *mutator.Mapping, 10)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	if err := Watch(client, func(mapping *mutator.Mapping) { updates <- mapping }, stop); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{
+		"clusterdomainmappings/default: all namespaces",
+		"clusterdomainmappings/default: fallthrough",
+		"clusterdomainmappings/default: suffix example.org=example.com",
+	}, nextUpdate(t, updates).Describe())
+
+	obj := newObject("DomainMapping", "staging", "staging", "example.org", "staging.example.com")
+	if _, err := client.Resource(v1alpha1.DomainMappingResource).Namespace("staging").Create(context.TODO(), obj, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{
+		"domainmappings/staging: namespaces staging",
+		"domainmappings/staging: fallthrough",
+		"domainmappings/staging: suffix example.org=staging.example.com",
+		"clusterdomainmappings/default: all namespaces",
+		"clusterdomainmappings/default: fallthrough",
+		"clusterdomainmappings/default: suffix example.org=example.com",
+	}, nextUpdate(t, updates).Describe())
+
+	if err := client.Resource(v1alpha1.ClusterDomainMappingResource).Delete(context.TODO(), "default", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{
+		"domainmappings/staging: namespaces staging",
+		"domainmappings/staging: fallthrough",
+		"domainmappings/staging: suffix example.org=staging.example.com",
+	}, nextUpdate(t, updates).Describe())
+}
+
+func TestWatchTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { syncTimeout = timeout }(syncTimeout)
+	syncTimeout = 100 * time.Millisecond
+
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		v1alpha1.DomainMappingResource:        "DomainMappingList",
+		v1alpha1.ClusterDomainMappingResource: "ClusterDomainMappingList",
+	})
+	// listing fails as it does when the CRDs are not installed
+	client.PrependReactor("list", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewNotFound(action.GetResource().GroupResource(), "")
+	})
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	err := Watch(client, func(*mutator.Mapping) { t.Error("unexpected update") }, stop)
+	assert.Error(t, err)
+}
+
+func newObject(kind string, namespace string, name string, source string, target string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"domains": []interface{}{
+				map[string]interface{}{"source": source, "target": target},
+			},
+		},
+	}}
+	obj.SetAPIVersion(v1alpha1.SchemeGroupVersion.String())
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+func nextUpdate(t *testing.T, updates <-chan *mutator.Mapping) *mutator.Mapping {
+	t.Helper()
+	select {
+	case mapping := <-updates:
+		return mapping
+	case <-time.After(5 * time.Second):
+		t.Fatal("mapping not updated")
+		return nil
+	}
+}
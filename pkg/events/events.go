@@ -0,0 +1,38 @@
+package events
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// Component is the source of the events
+const Component = "muting"
+
+// Recorder emits events about mutated objects
+type Recorder struct {
+	record.EventRecorder
+
+	broadcaster record.EventBroadcaster
+}
+
+// NewRecorder returns a recorder that emits events through the client. Events
+// are queued and sent in the background so recording never blocks.
+func NewRecorder(client kubernetes.Interface) *Recorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{
+		Interface: client.CoreV1().Events(""),
+	})
+
+	return &Recorder{
+		EventRecorder: broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: Component}),
+		broadcaster:   broadcaster,
+	}
+}
+
+// Shutdown stops sending events, dropping any still queued
+func (r *Recorder) Shutdown() {
+	r.broadcaster.Shutdown()
+}
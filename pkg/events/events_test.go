@@ -0,0 +1,54 @@
+package events
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestRecorder(t *testing.T) {
+	var mu sync.Mutex
+	var events []*corev1.Event
+
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "events", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		event := action.(clienttesting.CreateAction).GetObject().(*corev1.Event)
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+		return true, event, nil
+	})
+
+	recorder := NewRecorder(client)
+	defer recorder.Shutdown()
+
+	ref := &corev1.ObjectReference{
+		APIVersion: "networking.k8s.io/v1",
+		Kind:       "Ingress",
+		Namespace:  "default",
+		Name:       "muting",
+	}
+	recorder.Eventf(ref, corev1.EventTypeNormal, "HostRewritten", "Rewrote host %s → %s", "a.example.org", "a.example.com")
+
+	if !assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) == 1
+	}, 5*time.Second, 10*time.Millisecond) {
+		return
+	}
+
+	event := events[0]
+	assert.Equal(t, corev1.EventTypeNormal, event.Type)
+	assert.Equal(t, "HostRewritten", event.Reason)
+	assert.Equal(t, "Rewrote host a.example.org → a.example.com", event.Message)
+	assert.Equal(t, *ref, event.InvolvedObject)
+	assert.Equal(t, "default", event.Namespace)
+	assert.Equal(t, Component, event.Source.Component)
+}
@@ -0,0 +1,156 @@
+package mutationconfig
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/mikelorant/muting/pkg/certificates"
+)
+
+// InjectCAFromAnnotation asks the cert-manager CA injector to set the CA
+// bundles of a webhook configuration from a certificate
+const InjectCAFromAnnotation = "cert-manager.io/inject-ca-from"
+
+var (
+	// IssuerResource is the cert-manager issuer resource
+	IssuerResource = schema.GroupVersionResource{Group: "cert-manager.io", Version: "v1", Resource: "issuers"}
+
+	// CertificateResource is the cert-manager certificate resource
+	CertificateResource = schema.GroupVersionResource{Group: "cert-manager.io", Version: "v1", Resource: "certificates"}
+)
+
+// GenerateIssuer returns a cert-manager CA issuer signing with the CA stored
+// in the secret, or a self-signed issuer without one
+func GenerateIssuer(issuerName string, webhookNamespace string, caSecretName string) *unstructured.Unstructured {
+	spec := map[string]interface{}{
+		"selfSigned": map[string]interface{}{},
+	}
+	if caSecretName != "" {
+		spec = map[string]interface{}{
+			"ca": map[string]interface{}{
+				"secretName": caSecretName,
+			},
+		}
+	}
+
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "cert-manager.io/v1",
+			"kind":       "Issuer",
+			"metadata": map[string]interface{}{
+				"name":      issuerName,
+				"namespace": webhookNamespace,
+			},
+			"spec": spec,
+		},
+	}
+}
+
+// GenerateCACertificate returns a cert-manager CA certificate issued by the
+// issuer and stored in the secret, for a CA issuer to sign with
+func GenerateCACertificate(certificateName string, webhookNamespace string, secretName string, issuerName string, keyAlgorithm certificates.KeyAlgorithm, validity time.Duration) *unstructured.Unstructured {
+	return generateCertificate(certificateName, webhookNamespace, map[string]interface{}{
+		"isCA":       true,
+		"secretName": secretName,
+		"commonName": certificateName,
+		"duration":   validity.String(),
+		"privateKey": privateKey(keyAlgorithm),
+		"issuerRef": map[string]interface{}{
+			"name": issuerName,
+			"kind": "Issuer",
+		},
+	})
+}
+
+// GenerateCertificate returns a cert-manager certificate for the webhook
+// service issued by the issuer and stored in the secret
+func GenerateCertificate(certificateName string, webhookNamespace string, secretName string, issuerName string, commonName string, dnsNames []string, keyAlgorithm certificates.KeyAlgorithm, validity time.Duration) *unstructured.Unstructured {
+	names := make([]interface{}, len(dnsNames))
+	for i, name := range dnsNames {
+		names[i] = name
+	}
+
+	return generateCertificate(certificateName, webhookNamespace, map[string]interface{}{
+		"secretName": secretName,
+		"commonName": commonName,
+		"dnsNames":   names,
+		"duration":   validity.String(),
+		"privateKey": privateKey(keyAlgorithm),
+		"issuerRef": map[string]interface{}{
+			"name": issuerName,
+			"kind": "Issuer",
+		},
+	})
+}
+
+// generateCertificate returns a cert-manager certificate with the spec
+func generateCertificate(certificateName string, webhookNamespace string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "cert-manager.io/v1",
+			"kind":       "Certificate",
+			"metadata": map[string]interface{}{
+				"name":      certificateName,
+				"namespace": webhookNamespace,
+			},
+			"spec": spec,
+		},
+	}
+}
+
+// privateKey returns the cert-manager private key settings of a key algorithm
+func privateKey(keyAlgorithm certificates.KeyAlgorithm) map[string]interface{} {
+	key := map[string]interface{}{
+		"encoding": "PKCS8",
+	}
+
+	switch keyAlgorithm {
+	case certificates.RSA2048:
+		key["algorithm"], key["size"] = "RSA", int64(2048)
+	case certificates.RSA3072:
+		key["algorithm"], key["size"] = "RSA", int64(3072)
+	case certificates.RSA4096:
+		key["algorithm"], key["size"] = "RSA", int64(4096)
+	case certificates.ECDSAP256:
+		key["algorithm"], key["size"] = "ECDSA", int64(256)
+	case certificates.ECDSAP384:
+		key["algorithm"], key["size"] = "ECDSA", int64(384)
+	case certificates.Ed25519:
+		key["algorithm"] = "Ed25519"
+	}
+
+	return key
+}
+
+// InjectCAFrom returns the inject-ca-from annotation value for a certificate
+func InjectCAFrom(webhookNamespace string, certificateName string) string {
+	return fmt.Sprint(webhookNamespace, "/", certificateName)
+}
+
+// ApplyUnstructured creates the object or updates the existing object
+func ApplyUnstructured(client dynamic.Interface, resource schema.GroupVersionResource, obj *unstructured.Unstructured) error {
+	resourceClient := client.Resource(resource).Namespace(obj.GetNamespace())
+
+	existing, err := resourceClient.Get(context.TODO(), obj.GetName(), metav1.GetOptions{})
+	if err != nil && apierrors.IsNotFound(err) {
+		if _, err := resourceClient.Create(context.TODO(), obj, metav1.CreateOptions{}); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else {
+		obj.SetResourceVersion(existing.GetResourceVersion())
+		if _, err := resourceClient.Update(context.TODO(), obj, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
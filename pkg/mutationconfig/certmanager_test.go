@@ -0,0 +1,96 @@
+package mutationconfig
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"github.com/mikelorant/muting/pkg/certificates"
+)
+
+func TestGenerateIssuer(t *testing.T) {
+	selfSigned := GenerateIssuer("muting-selfsigned", "default", "")
+	assert.Equal(t, "Issuer", selfSigned.GetKind())
+	assert.Equal(t, "muting-selfsigned", selfSigned.GetName())
+	assert.Equal(t, "default", selfSigned.GetNamespace())
+	assert.Equal(t, map[string]interface{}{"selfSigned": map[string]interface{}{}}, selfSigned.Object["spec"])
+
+	ca := GenerateIssuer("muting", "default", "muting-ca")
+	assert.Equal(t, map[string]interface{}{"ca": map[string]interface{}{"secretName": "muting-ca"}}, ca.Object["spec"])
+}
+
+func TestGenerateCACertificate(t *testing.T) {
+	certificate := GenerateCACertificate("muting-ca", "default", "muting-ca", "muting-selfsigned", certificates.ECDSAP256, 8760*time.Hour)
+	assert.Equal(t, "Certificate", certificate.GetKind())
+	assert.Equal(t, "muting-ca", certificate.GetName())
+	assert.Equal(t, map[string]interface{}{
+		"isCA":       true,
+		"secretName": "muting-ca",
+		"commonName": "muting-ca",
+		"duration":   "8760h0m0s",
+		"privateKey": map[string]interface{}{"encoding": "PKCS8", "algorithm": "ECDSA", "size": int64(256)},
+		"issuerRef":  map[string]interface{}{"name": "muting-selfsigned", "kind": "Issuer"},
+	}, certificate.Object["spec"])
+}
+
+func TestGenerateCertificate(t *testing.T) {
+	certificate := GenerateCertificate("muting", "default", "muting-tls", "muting", "muting.default.svc", []string{"muting", "muting.default.svc"}, certificates.RSA4096, 24*time.Hour)
+	assert.Equal(t, "Certificate", certificate.GetKind())
+	assert.Equal(t, "muting", certificate.GetName())
+	assert.Equal(t, "default", certificate.GetNamespace())
+	assert.Equal(t, map[string]interface{}{
+		"secretName": "muting-tls",
+		"commonName": "muting.default.svc",
+		"dnsNames":   []interface{}{"muting", "muting.default.svc"},
+		"duration":   "24h0m0s",
+		"privateKey": map[string]interface{}{"encoding": "PKCS8", "algorithm": "RSA", "size": int64(4096)},
+		"issuerRef":  map[string]interface{}{"name": "muting", "kind": "Issuer"},
+	}, certificate.Object["spec"])
+
+	// the certificate must survive a round trip through JSON
+	_, err := certificate.MarshalJSON()
+	assert.NoError(t, err)
+}
+
+func TestPrivateKey(t *testing.T) {
+	tc := []struct {
+		algorithm certificates.KeyAlgorithm
+		key       map[string]interface{}
+	}{
+		{certificates.RSA2048, map[string]interface{}{"encoding": "PKCS8", "algorithm": "RSA", "size": int64(2048)}},
+		{certificates.RSA3072, map[string]interface{}{"encoding": "PKCS8", "algorithm": "RSA", "size": int64(3072)}},
+		{certificates.RSA4096, map[string]interface{}{"encoding": "PKCS8", "algorithm": "RSA", "size": int64(4096)}},
+		{certificates.ECDSAP256, map[string]interface{}{"encoding": "PKCS8", "algorithm": "ECDSA", "size": int64(256)}},
+		{certificates.ECDSAP384, map[string]interface{}{"encoding": "PKCS8", "algorithm": "ECDSA", "size": int64(384)}},
+		{certificates.Ed25519, map[string]interface{}{"encoding": "PKCS8", "algorithm": "Ed25519"}},
+	}
+
+	assert.Len(t, tc, len(certificates.KeyAlgorithms), "every key algorithm is covered")
+	for _, test := range tc {
+		t.Run(string(test.algorithm), func(t *testing.T) {
+			assert.Equal(t, test.key, privateKey(test.algorithm))
+		})
+	}
+}
+
+func TestApplyUnstructured(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		IssuerResource: "IssuerList",
+	})
+
+	assert.NoError(t, ApplyUnstructured(client, IssuerResource, GenerateIssuer("muting", "default", "")))
+	assert.NoError(t, ApplyUnstructured(client, IssuerResource, GenerateIssuer("muting", "default", "muting-ca")))
+
+	issuer, err := client.Resource(IssuerResource).Namespace("default").Get(context.TODO(), "muting", metav1.GetOptions{})
+	if assert.NoError(t, err) {
+		secretName, _, _ := unstructured.NestedString(issuer.Object, "spec", "ca", "secretName")
+		assert.Equal(t, "muting-ca", secretName)
+	}
+}
@@ -3,14 +3,61 @@ package mutationconfig
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/mikelorant/muting/pkg/certificates"
+)
+
+// Resource is a kind of resource the webhook mutates
+type Resource struct {
+	Group    string
+	Versions []string
+	Resource string
+}
+
+var (
+	// IngressResources are the Kubernetes ingress resources
+	IngressResources = []Resource{
+		{Group: "networking.k8s.io", Versions: []string{"v1"}, Resource: "ingresses"},
+	}
+
+	// IstioResources are the Istio resources with hosts
+	IstioResources = []Resource{
+		{Group: "networking.istio.io", Versions: []string{"*"}, Resource: "virtualservices"},
+		{Group: "networking.istio.io", Versions: []string{"*"}, Resource: "gateways"},
+	}
+
+	// GatewayAPIResources are the Gateway API resources with hostnames
+	GatewayAPIResources = []Resource{
+		{Group: "gateway.networking.k8s.io", Versions: []string{"*"}, Resource: "httproutes"},
+		{Group: "gateway.networking.k8s.io", Versions: []string{"*"}, Resource: "grpcroutes"},
+		{Group: "gateway.networking.k8s.io", Versions: []string{"*"}, Resource: "tlsroutes"},
+		{Group: "gateway.networking.k8s.io", Versions: []string{"*"}, Resource: "gateways"},
+	}
+
+	// OpenShiftResources are the OpenShift routes
+	OpenShiftResources = []Resource{
+		{Group: "route.openshift.io", Versions: []string{"v1"}, Resource: "routes"},
+	}
+
+	// TraefikResources are the Traefik ingress routes
+	TraefikResources = []Resource{
+		{Group: "traefik.io", Versions: []string{"*"}, Resource: "ingressroutes"},
+		{Group: "traefik.io", Versions: []string{"*"}, Resource: "ingressroutetcps"},
+		{Group: "traefik.containo.us", Versions: []string{"*"}, Resource: "ingressroutes"},
+		{Group: "traefik.containo.us", Versions: []string{"*"}, Resource: "ingressroutetcps"},
+	}
 )
 
 func CreateClient() *kubernetes.Clientset {
@@ -23,10 +70,24 @@ func CreateClient() *kubernetes.Clientset {
 	return kubeClient
 }
 
-func GenerateMutationConfig(mutationCfgName string, webhookNamespace string, webhookService string, caCert *bytes.Buffer) (mutateConfig *admissionregistrationv1.MutatingWebhookConfiguration) {
+func CreateDynamicClient() dynamic.Interface {
+	config := ctrl.GetConfigOrDie()
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		log.Error("Failed to configure dynamic client.")
+	}
+
+	return dynamicClient
+}
+
+// GenerateMutationConfig returns the mutating webhook configuration. When
+// injectCAFrom names a cert-manager certificate the CA bundle is omitted and
+// left to the cert-manager CA injector.
+func GenerateMutationConfig(mutationCfgName string, webhookNamespace string, webhookService string, caCert *bytes.Buffer, injectCAFrom string, resources []Resource, reviewVersions []string) (mutateConfig *admissionregistrationv1.MutatingWebhookConfiguration) {
 	path := "/mutate"
 	fail := admissionregistrationv1.Fail
-	sideEffect := admissionregistrationv1.SideEffectClassNone
+	// events may be recorded for mutated objects, but never for dry runs
+	sideEffect := admissionregistrationv1.SideEffectClassNoneOnDryRun
 
 	service := &admissionregistrationv1.ServiceReference{
 		Name:      webhookService,
@@ -39,28 +100,19 @@ func GenerateMutationConfig(mutationCfgName string, webhookNamespace string, web
 
 	mutateConfig = &admissionregistrationv1.MutatingWebhookConfiguration{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: mutationCfgName,
+			Name:        mutationCfgName,
+			Annotations: injectCAAnnotations(injectCAFrom),
 		},
 		Webhooks: []admissionregistrationv1.MutatingWebhook{{
 			Name:                    fmt.Sprint(webhookService, ".", webhookNamespace, ".svc.cluster.local"),
-			AdmissionReviewVersions: []string{"v1"},
+			AdmissionReviewVersions: reviewVersions,
 			SideEffects:             &sideEffect,
 			ClientConfig: admissionregistrationv1.WebhookClientConfig{
-				CABundle: caCert.Bytes(), // CA bundle created earlier
+				CABundle: caBundle(caCert, injectCAFrom), // CA bundle created earlier
 				Service:  service,
 				// URL: &url,
 			},
-			Rules: []admissionregistrationv1.RuleWithOperations{{
-				Operations: []admissionregistrationv1.OperationType{
-					admissionregistrationv1.Create,
-					admissionregistrationv1.Update,
-				},
-				Rule: admissionregistrationv1.Rule{
-					APIGroups:   []string{"networking.k8s.io"},
-					APIVersions: []string{"v1"},
-					Resources:   []string{"ingresses"},
-				},
-			}},
+			Rules: generateRules(resources),
 			NamespaceSelector: &metav1.LabelSelector{
 				MatchLabels: map[string]string{
 					(webhookService): "enabled",
@@ -73,7 +125,85 @@ func GenerateMutationConfig(mutationCfgName string, webhookNamespace string, web
 	return mutateConfig
 }
 
-func ApplyMutationConfig(client *kubernetes.Clientset, mutationCfgName string, mutateConfig *admissionregistrationv1.MutatingWebhookConfiguration) error {
+// GenerateValidationConfig returns the validating webhook configuration,
+// omitting the CA bundle like GenerateMutationConfig
+func GenerateValidationConfig(validationCfgName string, webhookNamespace string, webhookService string, caCert *bytes.Buffer, injectCAFrom string, resources []Resource, reviewVersions []string) (validateConfig *admissionregistrationv1.ValidatingWebhookConfiguration) {
+	path := "/validate"
+	fail := admissionregistrationv1.Fail
+	sideEffect := admissionregistrationv1.SideEffectClassNone
+
+	service := &admissionregistrationv1.ServiceReference{
+		Name:      webhookService,
+		Namespace: webhookNamespace,
+		Path:      &path,
+	}
+
+	validateConfig = &admissionregistrationv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        validationCfgName,
+			Annotations: injectCAAnnotations(injectCAFrom),
+		},
+		Webhooks: []admissionregistrationv1.ValidatingWebhook{{
+			Name:                    fmt.Sprint(webhookService, ".", webhookNamespace, ".svc.cluster.local"),
+			AdmissionReviewVersions: reviewVersions,
+			SideEffects:             &sideEffect,
+			ClientConfig: admissionregistrationv1.WebhookClientConfig{
+				CABundle: caBundle(caCert, injectCAFrom),
+				Service:  service,
+			},
+			Rules: generateRules(resources),
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					(webhookService): "enabled",
+				},
+			},
+			FailurePolicy: &fail,
+		}},
+	}
+
+	return validateConfig
+}
+
+func injectCAAnnotations(injectCAFrom string) map[string]string {
+	if injectCAFrom == "" {
+		return nil
+	}
+
+	return map[string]string{
+		InjectCAFromAnnotation: injectCAFrom,
+	}
+}
+
+func caBundle(caCert *bytes.Buffer, injectCAFrom string) []byte {
+	if injectCAFrom != "" || caCert == nil {
+		return nil
+	}
+
+	return caCert.Bytes()
+}
+
+func generateRules(resources []Resource) (rules []admissionregistrationv1.RuleWithOperations) {
+	for _, resource := range resources {
+		rules = append(rules, admissionregistrationv1.RuleWithOperations{
+			Operations: []admissionregistrationv1.OperationType{
+				admissionregistrationv1.Create,
+				admissionregistrationv1.Update,
+			},
+			Rule: admissionregistrationv1.Rule{
+				APIGroups:   []string{resource.Group},
+				APIVersions: resource.Versions,
+				Resources:   []string{resource.Resource},
+			},
+		})
+	}
+
+	return rules
+}
+
+// ApplyMutationConfig creates or updates the mutating webhook configuration.
+// The CA bundle of each webhook is merged with the existing one, so servers
+// yet to serve a certificate signed by a new CA are still trusted.
+func ApplyMutationConfig(client kubernetes.Interface, mutationCfgName string, mutateConfig *admissionregistrationv1.MutatingWebhookConfiguration) error {
 	existingConfig, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), mutationCfgName, metav1.GetOptions{})
 	if err != nil && apierrors.IsNotFound(err) {
 		if _, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Create(context.TODO(), mutateConfig, metav1.CreateOptions{}); err != nil {
@@ -83,6 +213,13 @@ func ApplyMutationConfig(client *kubernetes.Clientset, mutationCfgName string, m
 		return err
 	} else {
 		mutateConfig.ObjectMeta.ResourceVersion = existingConfig.ObjectMeta.ResourceVersion
+		// merge the CA bundles, keeping those injected by cert-manager until
+		// it injects again
+		for i := range mutateConfig.Webhooks {
+			if i < len(existingConfig.Webhooks) {
+				mutateConfig.Webhooks[i].ClientConfig.CABundle = mergeCABundle(existingConfig.Webhooks[i].ClientConfig.CABundle, mutateConfig.Webhooks[i].ClientConfig.CABundle)
+			}
+		}
 		if _, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Update(context.TODO(), mutateConfig, metav1.UpdateOptions{}); err != nil {
 			return err
 		}
@@ -90,3 +227,126 @@ func ApplyMutationConfig(client *kubernetes.Clientset, mutationCfgName string, m
 
 	return nil
 }
+
+// ApplyValidationConfig creates or updates the validating webhook
+// configuration, merging the CA bundles as ApplyMutationConfig does
+func ApplyValidationConfig(client kubernetes.Interface, validationCfgName string, validateConfig *admissionregistrationv1.ValidatingWebhookConfiguration) error {
+	existingConfig, err := client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(context.TODO(), validationCfgName, metav1.GetOptions{})
+	if err != nil && apierrors.IsNotFound(err) {
+		if _, err := client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Create(context.TODO(), validateConfig, metav1.CreateOptions{}); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else {
+		validateConfig.ObjectMeta.ResourceVersion = existingConfig.ObjectMeta.ResourceVersion
+		for i := range validateConfig.Webhooks {
+			if i < len(existingConfig.Webhooks) {
+				validateConfig.Webhooks[i].ClientConfig.CABundle = mergeCABundle(existingConfig.Webhooks[i].ClientConfig.CABundle, validateConfig.Webhooks[i].ClientConfig.CABundle)
+			}
+		}
+		if _, err := client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Update(context.TODO(), validateConfig, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeCABundle returns the existing CA bundle when there is no new one, as
+// when cert-manager injects it, otherwise the new one merged with the
+// certificates of the existing one that are still valid
+func mergeCABundle(existing []byte, caBundle []byte) []byte {
+	if len(caBundle) == 0 {
+		return existing
+	}
+	return certificates.MergeCABundle(existing, caBundle, time.Now())
+}
+
+// PatchCABundle adds the CA certificate to the CA bundles of the webhooks of
+// the mutating webhook configuration, and of the validating webhook
+// configuration when there is one. The certificates of the bundles that are
+// still valid are kept, so servers yet to serve a certificate signed by the
+// new CA are still trusted.
+func PatchCABundle(client kubernetes.Interface, cfgName string, caCert []byte) error {
+	mutateConfig, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), cfgName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	var bundles [][]byte
+	for _, webhook := range mutateConfig.Webhooks {
+		bundles = append(bundles, webhook.ClientConfig.CABundle)
+	}
+	patch, err := caBundlePatch(mutateConfig.ObjectMeta.ResourceVersion, bundles, caCert)
+	if err != nil {
+		return err
+	}
+	if _, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Patch(context.TODO(), cfgName, types.JSONPatchType, patch, metav1.PatchOptions{}); err != nil {
+		return err
+	}
+
+	validateConfig, err := client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(context.TODO(), cfgName, metav1.GetOptions{})
+	if err != nil && apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	bundles = nil
+	for _, webhook := range validateConfig.Webhooks {
+		bundles = append(bundles, webhook.ClientConfig.CABundle)
+	}
+	patch, err = caBundlePatch(validateConfig.ObjectMeta.ResourceVersion, bundles, caCert)
+	if err != nil {
+		return err
+	}
+	if _, err := client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Patch(context.TODO(), cfgName, types.JSONPatchType, patch, metav1.PatchOptions{}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetCABundles returns the CA bundles of the webhooks of the mutating webhook
+// configuration, followed by those of the validating webhook configuration
+// when there is one
+func GetCABundles(client kubernetes.Interface, cfgName string) (bundles [][]byte, err error) {
+	mutateConfig, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), cfgName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, webhook := range mutateConfig.Webhooks {
+		bundles = append(bundles, webhook.ClientConfig.CABundle)
+	}
+
+	validateConfig, err := client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(context.TODO(), cfgName, metav1.GetOptions{})
+	if err != nil && apierrors.IsNotFound(err) {
+		return bundles, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, webhook := range validateConfig.Webhooks {
+		bundles = append(bundles, webhook.ClientConfig.CABundle)
+	}
+
+	return bundles, nil
+}
+
+// caBundlePatch returns a JSON patch adding the CA certificate to the CA
+// bundle of each webhook, which fails when the configuration has changed
+// since it was read
+func caBundlePatch(resourceVersion string, bundles [][]byte, caCert []byte) ([]byte, error) {
+	patch := []map[string]interface{}{
+		{"op": "test", "path": "/metadata/resourceVersion", "value": resourceVersion},
+	}
+	for i, bundle := range bundles {
+		patch = append(patch, map[string]interface{}{
+			"op":    "add",
+			"path":  fmt.Sprintf("/webhooks/%d/clientConfig/caBundle", i),
+			"value": certificates.MergeCABundle(bundle, caCert, time.Now()),
+		})
+	}
+
+	return json.Marshal(patch)
+}
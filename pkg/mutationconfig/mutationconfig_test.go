@@ -0,0 +1,117 @@
+package mutationconfig
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/mikelorant/muting/pkg/certificates"
+)
+
+func TestPatchCABundle(t *testing.T) {
+	oldCA := newCAPEM(t, time.Hour)
+	newCA := newCAPEM(t, time.Hour)
+
+	mutateConfig := GenerateMutationConfig("muting", "default", "muting", bytes.NewBuffer(oldCA), "", IngressResources, []string{"v1"})
+	mutateConfig.ResourceVersion = "1"
+	validateConfig := GenerateValidationConfig("muting", "default", "muting", bytes.NewBuffer(oldCA), "", IngressResources, []string{"v1"})
+	validateConfig.ResourceVersion = "1"
+	client := fake.NewSimpleClientset(mutateConfig, validateConfig)
+
+	// the new CA is trusted ahead of the old one
+	assert.NoError(t, PatchCABundle(client, "muting", newCA))
+	bundles, err := GetCABundles(client, "muting")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{append(append([]byte{}, newCA...), oldCA...), append(append([]byte{}, newCA...), oldCA...)}, bundles)
+
+	assert.Error(t, PatchCABundle(client, "missing", newCA))
+}
+
+func TestPatchCABundleWithoutValidation(t *testing.T) {
+	oldCA := newCAPEM(t, time.Hour)
+	newCA := newCAPEM(t, time.Hour)
+
+	mutateConfig := GenerateMutationConfig("muting", "default", "muting", bytes.NewBuffer(oldCA), "", IngressResources, []string{"v1"})
+	mutateConfig.ResourceVersion = "1"
+	client := fake.NewSimpleClientset(mutateConfig)
+
+	assert.NoError(t, PatchCABundle(client, "muting", newCA))
+	bundles, err := GetCABundles(client, "muting")
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{append(append([]byte{}, newCA...), oldCA...)}, bundles)
+}
+
+func TestApplyMutationConfig(t *testing.T) {
+	oldCA := newCAPEM(t, time.Hour)
+	newCA := newCAPEM(t, time.Hour)
+	client := fake.NewSimpleClientset()
+
+	mutateConfig := GenerateMutationConfig("muting", "default", "muting", bytes.NewBuffer(oldCA), "", IngressResources, []string{"v1"})
+	assert.NoError(t, ApplyMutationConfig(client, "muting", mutateConfig))
+
+	// a new CA is merged with the existing bundle rather than replacing it
+	mutateConfig = GenerateMutationConfig("muting", "default", "muting", bytes.NewBuffer(newCA), "", IngressResources, []string{"v1"})
+	assert.NoError(t, ApplyMutationConfig(client, "muting", mutateConfig))
+	applied, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), "muting", metav1.GetOptions{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, append(append([]byte{}, newCA...), oldCA...), applied.Webhooks[0].ClientConfig.CABundle)
+	}
+
+	// an injected bundle is kept
+	mutateConfig = GenerateMutationConfig("muting", "default", "muting", nil, InjectCAFrom("default", "muting"), IngressResources, []string{"v1"})
+	assert.NoError(t, ApplyMutationConfig(client, "muting", mutateConfig))
+	applied, err = client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), "muting", metav1.GetOptions{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, append(append([]byte{}, newCA...), oldCA...), applied.Webhooks[0].ClientConfig.CABundle)
+	}
+}
+
+func TestApplyValidationConfig(t *testing.T) {
+	oldCA := newCAPEM(t, time.Hour)
+	newCA := newCAPEM(t, time.Hour)
+	client := fake.NewSimpleClientset()
+
+	validateConfig := GenerateValidationConfig("muting", "default", "muting", bytes.NewBuffer(oldCA), "", IngressResources, []string{"v1"})
+	assert.NoError(t, ApplyValidationConfig(client, "muting", validateConfig))
+
+	validateConfig = GenerateValidationConfig("muting", "default", "muting", bytes.NewBuffer(newCA), "", IngressResources, []string{"v1"})
+	assert.NoError(t, ApplyValidationConfig(client, "muting", validateConfig))
+	applied, err := client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(context.TODO(), "muting", metav1.GetOptions{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, append(append([]byte{}, newCA...), oldCA...), applied.Webhooks[0].ClientConfig.CABundle)
+	}
+}
+
+func TestGenerateMutationConfig(t *testing.T) {
+	caCert := newCAPEM(t, time.Hour)
+
+	mutateConfig := GenerateMutationConfig("muting", "default", "muting", bytes.NewBuffer(caCert), "", IngressResources, []string{"v1"})
+	assert.Equal(t, caCert, mutateConfig.Webhooks[0].ClientConfig.CABundle)
+	assert.Empty(t, mutateConfig.Annotations)
+
+	// the CA bundle is left to the cert-manager CA injector
+	mutateConfig = GenerateMutationConfig("muting", "default", "muting", nil, InjectCAFrom("default", "muting"), IngressResources, []string{"v1"})
+	assert.Empty(t, mutateConfig.Webhooks[0].ClientConfig.CABundle)
+	assert.Equal(t, map[string]string{InjectCAFromAnnotation: "default/muting"}, mutateConfig.Annotations)
+
+	validateConfig := GenerateValidationConfig("muting", "default", "muting", nil, InjectCAFrom("default", "muting"), IngressResources, []string{"v1"})
+	assert.Empty(t, validateConfig.Webhooks[0].ClientConfig.CABundle)
+	assert.Equal(t, map[string]string{InjectCAFromAnnotation: "default/muting"}, validateConfig.Annotations)
+}
+
+// newCAPEM returns the PEM of a new CA certificate valid for the validity
+// period
+func newCAPEM(t *testing.T, validity time.Duration) []byte {
+	t.Helper()
+
+	ca, err := certificates.NewCACertificate(certificates.ECDSAP256, validity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca.GetCertificatePEM().Bytes()
+}
@@ -0,0 +1,55 @@
+package mutator
+
+import (
+	"strings"
+)
+
+// annotationFields locates the annotations with the given keys, whose values
+// are lists of hosts separated by commas or spaces
+func annotationFields(annotations map[string]string, keys []string) []Field {
+	var fields []Field
+	for _, key := range keys {
+		value, ok := annotations[key]
+		if !ok {
+			continue
+		}
+		fields = append(fields, Field{
+			Path:    "/metadata/annotations/" + escapeJSONPointer(key),
+			Value:   value,
+			Rewrite: rewriteHostList,
+		})
+	}
+	return fields
+}
+
+// rewriteHostList rewrites each host of a list separated by commas or
+// spaces, keeping the separators as they are
+func rewriteHostList(value string, replace func(host string) string) string {
+	var b strings.Builder
+
+	start := -1
+	for i, c := range value {
+		if c == ',' || c == ' ' || c == '\t' || c == '\n' {
+			if start >= 0 {
+				b.WriteString(replace(value[start:i]))
+				start = -1
+			}
+			b.WriteRune(c)
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		b.WriteString(replace(value[start:]))
+	}
+
+	return b.String()
+}
+
+// escapeJSONPointer escapes a reference token of a JSON pointer as described
+// in RFC 6901
+func escapeJSONPointer(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
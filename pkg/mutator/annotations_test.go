@@ -0,0 +1,32 @@
+package mutator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteHostList(t *testing.T) {
+	replace := strings.ToUpper
+
+	tc := []struct {
+		value string
+		want  string
+	}{
+		{"a.org", "A.ORG"},
+		{"a.org,b.org", "A.ORG,B.ORG"},
+		{"a.org, b.org  c.org", "A.ORG, B.ORG  C.ORG"},
+		{",a.org,", ",A.ORG,"},
+		{"", ""},
+	}
+
+	for _, test := range tc {
+		assert.Equal(t, test.want, rewriteHostList(test.value, replace), test.value)
+	}
+}
+
+func TestEscapeJSONPointer(t *testing.T) {
+	assert.Equal(t, "external-dns.alpha.kubernetes.io~1hostname", escapeJSONPointer("external-dns.alpha.kubernetes.io/hostname"))
+	assert.Equal(t, "a~0~1b~01", escapeJSONPointer("a~/b~1"))
+}
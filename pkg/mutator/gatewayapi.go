@@ -0,0 +1,78 @@
+package mutator
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// GatewayAPIGroup is the API group of the Gateway API resources
+const GatewayAPIGroup = "gateway.networking.k8s.io"
+
+func init() {
+	RegisterHandler(schema.GroupKind{Group: GatewayAPIGroup, Kind: "HTTPRoute"}, routeHandler)
+	RegisterHandler(schema.GroupKind{Group: GatewayAPIGroup, Kind: "GRPCRoute"}, routeHandler)
+	RegisterHandler(schema.GroupKind{Group: GatewayAPIGroup, Kind: "TLSRoute"}, routeHandler)
+	RegisterHandler(schema.GroupKind{Group: GatewayAPIGroup, Kind: "Gateway"}, gatewayHandler)
+}
+
+// routeHandler locates the hostnames of a Gateway API route
+func routeHandler(object []byte) ([]Field, error) {
+	obj, err := decodeUnstructured(object)
+	if err != nil {
+		return nil, err
+	}
+
+	hostnames, _, err := unstructured.NestedStringSlice(obj, "spec", "hostnames")
+	if err != nil {
+		return nil, fmt.Errorf("invalid spec.hostnames: %w", err)
+	}
+
+	var fields []Field
+	for i, hostname := range hostnames {
+		fields = append(fields, Field{
+			Path:  fmt.Sprintf("/spec/hostnames/%d", i),
+			Value: hostname,
+		})
+	}
+
+	return fields, nil
+}
+
+// gatewayHandler locates the hostnames of the listeners of a Gateway API
+// gateway. Listeners without a hostname match all hosts and are skipped.
+func gatewayHandler(object []byte) ([]Field, error) {
+	obj, err := decodeUnstructured(object)
+	if err != nil {
+		return nil, err
+	}
+
+	listeners, _, err := unstructured.NestedSlice(obj, "spec", "listeners")
+	if err != nil {
+		return nil, fmt.Errorf("invalid spec.listeners: %w", err)
+	}
+
+	var fields []Field
+	for i, listener := range listeners {
+		listener, ok := listener.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid spec.listeners[%d]", i)
+		}
+
+		hostname, found, err := unstructured.NestedString(listener, "hostname")
+		if err != nil {
+			return nil, fmt.Errorf("invalid spec.listeners[%d].hostname: %w", i, err)
+		}
+		if !found {
+			continue
+		}
+
+		fields = append(fields, Field{
+			Path:  fmt.Sprintf("/spec/listeners/%d/hostname", i),
+			Value: hostname,
+		})
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,139 @@
+package mutator
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Field is a hostname-bearing value within a resource
+type Field struct {
+	// Path is the JSON pointer to the value
+	Path string
+	// Value is the current value
+	Value string
+	// Rewrite rewrites the hosts within the value when it is more than a
+	// single host. When nil the value is rewritten as one host.
+	Rewrite func(value string, replace func(host string) string) string
+}
+
+// Handler locates the hostname-bearing fields of a kind of resource
+type Handler func(object []byte) ([]Field, error)
+
+var (
+	handlersMu sync.RWMutex
+	handlers   = map[schema.GroupKind]Handler{}
+)
+
+func init() {
+	RegisterHandler(schema.GroupKind{Group: "networking.k8s.io", Kind: "Ingress"}, ingressHandler)
+}
+
+// RegisterHandler sets the handler for a kind of resource, replacing any
+// existing handler for the kind
+func RegisterHandler(kind schema.GroupKind, handler Handler) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlers[kind] = handler
+}
+
+// lookupHandler returns the handler for a kind of resource
+func lookupHandler(kind schema.GroupKind) (Handler, bool) {
+	handlersMu.RLock()
+	defer handlersMu.RUnlock()
+	handler, ok := handlers[kind]
+	return handler, ok
+}
+
+// Hosts returns the hosts of the object of the review, located as Mutate
+// locates them, including the hosts of the annotations with the given keys.
+// Objects of kinds without a handler have no hosts.
+func Hosts(review *Review, annotations []string) ([]string, error) {
+	fields, _, _, err := locateFields(review, annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []string
+	for _, field := range fields {
+		if field.Value == "" {
+			continue
+		}
+		field.rewrite(func(host string) string {
+			if host != "" {
+				hosts = append(hosts, host)
+			}
+			return host
+		})
+	}
+	return hosts, nil
+}
+
+// locateFields locates the fields of the object of the review with the
+// handler registered for its kind, along with the fields of the annotations
+// with the given keys. It returns the metadata of the object and whether its
+// kind is supported.
+func locateFields(review *Review, annotations []string) ([]Field, *metav1.PartialObjectMetadata, bool, error) {
+	object := &metav1.PartialObjectMetadata{}
+
+	kind := schema.GroupKind{Group: review.Context.Kind.Group, Kind: review.Context.Kind.Kind}
+	handler, supported := lookupHandler(kind)
+	if !supported {
+		return nil, object, false, nil
+	}
+
+	raw := review.request.Object.Raw
+	fields, err := handler(raw)
+	if err != nil {
+		return nil, nil, true, &BadRequest{fmt.Sprintf("Failed to unmarshal %s from AdmissionRequest: %s", kind, err.Error())}
+	}
+
+	// locate the hosts of the annotations of the resource
+	if err := json.Unmarshal(raw, object); err != nil {
+		return nil, nil, true, &BadRequest{fmt.Sprintf("Failed to unmarshal metadata from AdmissionRequest: %s", err.Error())}
+	}
+	fields = append(fields, annotationFields(object.Annotations, annotations)...)
+
+	return fields, object, true, nil
+}
+
+// rewrite returns the rewritten value of the field
+func (f Field) rewrite(replace func(host string) string) string {
+	if f.Rewrite != nil {
+		return f.Rewrite(f.Value, replace)
+	}
+	return replace(f.Value)
+}
+
+// ingressHandler locates the rule hosts of an ingress and the hosts listed
+// for TLS
+func ingressHandler(object []byte) ([]Field, error) {
+	var ingress networking.Ingress
+	if err := json.Unmarshal(object, &ingress); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal ingress: %w", err)
+	}
+
+	var fields []Field
+	for i, rule := range ingress.Spec.Rules {
+		fields = append(fields, Field{
+			Path:  fmt.Sprintf("/spec/rules/%d/host", i),
+			Value: rule.Host,
+		})
+	}
+
+	// TLS hosts are rewritten so certificates match the rules
+	for i, tls := range ingress.Spec.TLS {
+		for j, host := range tls.Hosts {
+			fields = append(fields, Field{
+				Path:  fmt.Sprintf("/spec/tls/%d/hosts/%d", i, j),
+				Value: host,
+			})
+		}
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,49 @@
+package mutator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHosts(t *testing.T) {
+	tc := []struct {
+		name        string
+		testdata    string
+		annotations []string
+		want        []string
+	}{
+		{
+			name:     "ingress",
+			testdata: "valid-request-mixed-tls.json",
+			want:     []string{"muting-a.test.one", "muting-b.test.one", "muting-c.test.one", "muting-a.test.one", "muting-c.test.one"},
+		},
+		{
+			name:        "annotations",
+			testdata:    "valid-request-annotations.json",
+			annotations: []string{"nginx.ingress.kubernetes.io/server-alias"},
+			want:        []string{"muting.test.one", "muting-b.test.one", "muting-c.test.three"},
+		},
+		{
+			name:     "traefik rule",
+			testdata: "valid-request-traefik-ingressroute.json",
+			want:     []string{"muting-a.test.one", "test.one", "*.test.one"},
+		},
+		{
+			name:     "unsupported kind",
+			testdata: "valid-request-unsupported-kind.json",
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			review, err := DecodeReview(getTestData(t, test.testdata))
+			if err != nil {
+				t.Fatal(err)
+			}
+			hosts, err := Hosts(review, test.annotations)
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, hosts)
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package mutator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// IstioGroup is the API group of the Istio networking resources
+const IstioGroup = "networking.istio.io"
+
+func init() {
+	RegisterHandler(schema.GroupKind{Group: IstioGroup, Kind: "VirtualService"}, virtualServiceHandler)
+	RegisterHandler(schema.GroupKind{Group: IstioGroup, Kind: "Gateway"}, istioGatewayHandler)
+}
+
+// virtualServiceHandler locates the hosts of an Istio VirtualService
+func virtualServiceHandler(object []byte) ([]Field, error) {
+	obj, err := decodeUnstructured(object)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts, _, err := unstructured.NestedStringSlice(obj, "spec", "hosts")
+	if err != nil {
+		return nil, fmt.Errorf("invalid spec.hosts: %w", err)
+	}
+
+	var fields []Field
+	for i, host := range hosts {
+		fields = append(fields, Field{
+			Path:  fmt.Sprintf("/spec/hosts/%d", i),
+			Value: host,
+		})
+	}
+
+	return fields, nil
+}
+
+// istioGatewayHandler locates the hosts of the servers of an Istio Gateway.
+// Hosts may be prefixed with a namespace as namespace/host, only the host
+// is rewritten.
+func istioGatewayHandler(object []byte) ([]Field, error) {
+	obj, err := decodeUnstructured(object)
+	if err != nil {
+		return nil, err
+	}
+
+	servers, _, err := unstructured.NestedSlice(obj, "spec", "servers")
+	if err != nil {
+		return nil, fmt.Errorf("invalid spec.servers: %w", err)
+	}
+
+	var fields []Field
+	for i, server := range servers {
+		server, ok := server.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid spec.servers[%d]", i)
+		}
+
+		hosts, _, err := unstructured.NestedStringSlice(server, "hosts")
+		if err != nil {
+			return nil, fmt.Errorf("invalid spec.servers[%d].hosts: %w", i, err)
+		}
+
+		for j, host := range hosts {
+			fields = append(fields, Field{
+				Path:    fmt.Sprintf("/spec/servers/%d/hosts/%d", i, j),
+				Value:   host,
+				Rewrite: rewriteNamespacedHost,
+			})
+		}
+	}
+
+	return fields, nil
+}
+
+// rewriteNamespacedHost rewrites the host of a namespace/host value
+func rewriteNamespacedHost(value string, replace func(host string) string) string {
+	if namespace, host, ok := strings.Cut(value, "/"); ok {
+		return namespace + "/" + replace(host)
+	}
+	return replace(value)
+}
+
+// decodeUnstructured decodes an object without knowing its type
+func decodeUnstructured(object []byte) (map[string]interface{}, error) {
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal(object, &obj); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal object: %w", err)
+	}
+	return obj, nil
+}
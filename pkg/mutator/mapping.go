@@ -0,0 +1,241 @@
+package mutator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// NamespaceRule applies its rules to the namespaces it selects, either by
+// name or by label, with an empty selector selecting every namespace. The
+// rules of a fallthrough rule are tried ahead of those that would otherwise
+// apply, rather than instead of them.
+type NamespaceRule struct {
+	Name        string                `json:"name"`
+	Namespaces  []string              `json:"namespaces"`
+	Selector    *metav1.LabelSelector `json:"selector"`
+	Domains     []Rule                `json:"domains"`
+	Fallthrough bool                  `json:"fallthrough,omitempty"`
+
+	selector labels.Selector
+}
+
+// Mapping selects the rules to rewrite hosts with for a namespace. The first
+// namespace rule selecting the namespace is used, otherwise the default rules
+// apply, after those of any fallthrough rules selecting it. Rules are ordered
+// and the first one matching a host is used.
+type Mapping struct {
+	Default []Rule          `json:"default"`
+	Rules   []NamespaceRule `json:"rules"`
+}
+
+// NamespaceLabels looks up the labels of a namespace
+type NamespaceLabels func(namespace string) (map[string]string, error)
+
+// LoadMapping reads a YAML mapping file
+func LoadMapping(file string) (*Mapping, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("LoadMapping: unable to read mapping file: %w", err)
+	}
+
+	mapping := &Mapping{}
+	if err := yaml.UnmarshalStrict(data, mapping); err != nil {
+		return nil, fmt.Errorf("LoadMapping: unable to parse mapping file: %w", err)
+	}
+
+	if err := mapping.Compile(); err != nil {
+		return nil, fmt.Errorf("LoadMapping: %w", err)
+	}
+
+	return mapping, nil
+}
+
+// Compile validates the mapping and prepares its rules and label selectors
+func (m *Mapping) Compile() error {
+	if err := compileRules(m.Default); err != nil {
+		return fmt.Errorf("invalid default domains: %w", err)
+	}
+
+	for i := range m.Rules {
+		rule := &m.Rules[i]
+
+		if len(rule.Namespaces) == 0 && rule.Selector == nil {
+			return fmt.Errorf("rule %d (%s) selects no namespaces", i, rule.Name)
+		}
+
+		if len(rule.Domains) == 0 {
+			return fmt.Errorf("rule %d (%s) has no domains", i, rule.Name)
+		}
+
+		if err := compileRules(rule.Domains); err != nil {
+			return fmt.Errorf("rule %d (%s) has invalid domains: %w", i, rule.Name, err)
+		}
+
+		if rule.Selector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(rule.Selector)
+			if err != nil {
+				return fmt.Errorf("rule %d (%s) has invalid selector: %w", i, rule.Name, err)
+			}
+			rule.selector = selector
+		}
+	}
+
+	return nil
+}
+
+// CombineMappings returns a mapping applying the rules of each of the
+// compiled mappings in turn, so the rules of earlier mappings take precedence
+func CombineMappings(mappings ...*Mapping) *Mapping {
+	combined := &Mapping{}
+	for _, m := range mappings {
+		if m == nil {
+			continue
+		}
+		combined.Default = append(combined.Default, m.Default...)
+		combined.Rules = append(combined.Rules, m.Rules...)
+	}
+	return combined
+}
+
+// Empty reports whether the mapping has no rules to rewrite hosts with
+func (m *Mapping) Empty() bool {
+	return m == nil || (len(m.Default) == 0 && len(m.Rules) == 0)
+}
+
+// SelectsLabels reports whether any rule selects namespaces by label
+func (m *Mapping) SelectsLabels() bool {
+	for _, rule := range m.Rules {
+		if rule.Selector != nil && !allNamespaces(rule.Selector) {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns the rules to rewrite hosts with for a namespace, those of
+// the fallthrough rules selecting it followed by those of the first other
+// rule selecting it, or the default rules. Namespace labels are only looked
+// up when a rule selects namespaces by label.
+func (m *Mapping) Select(namespace string, lookup NamespaceLabels) ([]Rule, error) {
+	var nsLabels labels.Set
+	var selected []Rule
+
+	for _, rule := range m.Rules {
+		matched := false
+		for _, name := range rule.Namespaces {
+			if name == namespace {
+				matched = true
+				break
+			}
+		}
+
+		if !matched && allNamespaces(rule.Selector) {
+			matched = true
+		} else if !matched && rule.selector != nil {
+			if nsLabels == nil {
+				if lookup == nil {
+					return nil, fmt.Errorf("unable to select namespace %s by label: no label lookup", namespace)
+				}
+				found, err := lookup(namespace)
+				if err != nil {
+					return nil, fmt.Errorf("unable to look up labels of namespace %s: %w", namespace, err)
+				}
+				nsLabels = labels.Set(found)
+				if nsLabels == nil {
+					nsLabels = labels.Set{}
+				}
+			}
+			matched = rule.selector.Matches(nsLabels)
+		}
+
+		if !matched {
+			continue
+		}
+		if rule.Fallthrough {
+			selected = append(selected, rule.Domains...)
+			continue
+		}
+		if len(selected) == 0 {
+			return rule.Domains, nil
+		}
+		return append(selected, rule.Domains...), nil
+	}
+
+	if len(selected) == 0 {
+		return m.Default, nil
+	}
+	return append(selected, m.Default...), nil
+}
+
+// Describe lists the namespaces each rule of the mapping selects and the
+// rules it rewrites hosts with, in order
+func (m *Mapping) Describe() []string {
+	if m == nil {
+		return nil
+	}
+
+	var lines []string
+	for _, rule := range m.Default {
+		lines = append(lines, fmt.Sprintf("default: %s", rule))
+	}
+
+	for i, rule := range m.Rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("rule %d", i)
+		}
+		if len(rule.Namespaces) > 0 {
+			lines = append(lines, fmt.Sprintf("%s: namespaces %s", name, strings.Join(rule.Namespaces, ",")))
+		}
+		if allNamespaces(rule.Selector) {
+			lines = append(lines, fmt.Sprintf("%s: all namespaces", name))
+		} else if rule.Selector != nil {
+			lines = append(lines, fmt.Sprintf("%s: selector %s", name, metav1.FormatLabelSelector(rule.Selector)))
+		}
+		if rule.Fallthrough {
+			lines = append(lines, fmt.Sprintf("%s: fallthrough", name))
+		}
+		for _, domain := range rule.Domains {
+			lines = append(lines, fmt.Sprintf("%s: %s", name, domain))
+		}
+	}
+
+	return lines
+}
+
+// allNamespaces reports whether the selector is empty, selecting every
+// namespace without looking up their labels
+func allNamespaces(selector *metav1.LabelSelector) bool {
+	return selector != nil && len(selector.MatchLabels) == 0 && len(selector.MatchExpressions) == 0
+}
+
+// DiffMappings returns the lines describing the new mapping that do not
+// describe the old one, and those describing the old one that no longer
+// describe the new one
+func DiffMappings(old *Mapping, new *Mapping) (added []string, removed []string) {
+	oldLines, newLines := old.Describe(), new.Describe()
+	return subtractLines(newLines, oldLines), subtractLines(oldLines, newLines)
+}
+
+// subtractLines returns the lines of a that are not in b
+func subtractLines(a []string, b []string) []string {
+	count := map[string]int{}
+	for _, line := range b {
+		count[line]++
+	}
+
+	var diff []string
+	for _, line := range a {
+		if count[line] > 0 {
+			count[line]--
+			continue
+		}
+		diff = append(diff, line)
+	}
+	return diff
+}
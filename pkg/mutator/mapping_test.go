@@ -0,0 +1,204 @@
+package mutator
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadMapping(t *testing.T) {
+	mapping, err := LoadMapping(filepath.Join("testdata", "mapping.yaml"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, []Rule{{Mode: SuffixMode, Source: "test.one", Target: "test.two"}}, mapping.Default)
+	assert.Len(t, mapping.Rules, 2)
+	assert.True(t, mapping.SelectsLabels())
+
+	_, err = LoadMapping(filepath.Join("testdata", "mapping-invalid.yaml"))
+	assert.Error(t, err)
+
+	_, err = LoadMapping(filepath.Join("testdata", "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestMappingSelect(t *testing.T) {
+	mapping, err := LoadMapping(filepath.Join("testdata", "mapping.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labels := map[string]map[string]string{
+		"staging": {},
+		"pr-1":    {"environment": "preview"},
+		"default": {},
+	}
+	lookup := func(namespace string) (map[string]string, error) {
+		return labels[namespace], nil
+	}
+
+	tc := []struct {
+		name      string
+		namespace string
+		lookup    NamespaceLabels
+		rules     []Rule
+		err       bool
+	}{
+		{
+			name:      "by name",
+			namespace: "staging",
+			lookup:    lookup,
+			rules:     []Rule{{Mode: SuffixMode, Source: "test.one", Target: "staging.test.two"}},
+		},
+		{
+			name:      "by name without lookup",
+			namespace: "staging",
+			rules:     []Rule{{Mode: SuffixMode, Source: "test.one", Target: "staging.test.two"}},
+		},
+		{
+			name:      "by label",
+			namespace: "pr-1",
+			lookup:    lookup,
+			rules: []Rule{
+				{Mode: SuffixMode, Source: "test.one", Target: "preview.test.two"},
+				{Mode: SuffixMode, Source: "test.three", Target: "preview.test.four"},
+			},
+		},
+		{
+			name:      "default",
+			namespace: "default",
+			lookup:    lookup,
+			rules:     []Rule{{Mode: SuffixMode, Source: "test.one", Target: "test.two"}},
+		},
+		{
+			name:      "missing lookup",
+			namespace: "default",
+			err:       true,
+		},
+		{
+			name:      "failed lookup",
+			namespace: "default",
+			lookup: func(string) (map[string]string, error) {
+				return nil, errors.New("not found")
+			},
+			err: true,
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			rules, err := mapping.Select(test.namespace, test.lookup)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.rules, rules)
+		})
+	}
+}
+
+func TestMappingSelectFallthrough(t *testing.T) {
+	base, err := LoadMapping(filepath.Join("testdata", "mapping.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := &Mapping{Rules: []NamespaceRule{{
+		Name:        "first",
+		Namespaces:  []string{"staging", "default"},
+		Domains:     []Rule{{Mode: SuffixMode, Source: "test.five", Target: "test.six"}},
+		Fallthrough: true,
+	}}}
+	if err := first.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	mapping := CombineMappings(first, base)
+
+	lookup := func(namespace string) (map[string]string, error) {
+		return map[string]string{}, nil
+	}
+
+	// the rules of the fallthrough rule come first, then those of the rule
+	// or default that would otherwise apply
+	rules, err := mapping.Select("staging", lookup)
+	assert.NoError(t, err)
+	assert.Equal(t, []Rule{
+		{Mode: SuffixMode, Source: "test.five", Target: "test.six"},
+		{Mode: SuffixMode, Source: "test.one", Target: "staging.test.two"},
+	}, rules)
+
+	rules, err = mapping.Select("default", lookup)
+	assert.NoError(t, err)
+	assert.Equal(t, []Rule{
+		{Mode: SuffixMode, Source: "test.five", Target: "test.six"},
+		{Mode: SuffixMode, Source: "test.one", Target: "test.two"},
+	}, rules)
+
+	rules, err = mapping.Select("other", lookup)
+	assert.NoError(t, err)
+	assert.Equal(t, []Rule{{Mode: SuffixMode, Source: "test.one", Target: "test.two"}}, rules)
+
+	assert.Contains(t, mapping.Describe(), "first: fallthrough")
+}
+
+func TestDiffMappings(t *testing.T) {
+	old, err := LoadMapping(filepath.Join("testdata", "mapping.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{
+		"default: suffix test.one=test.two",
+		"staging: namespaces staging",
+		"staging: suffix test.one=staging.test.two",
+		"preview: selector environment=preview",
+		"preview: suffix test.one=preview.test.two",
+		"preview: suffix test.three=preview.test.four",
+	}, old.Describe())
+
+	rules, err := ParseRules([]string{"test.one=test.three", "test.five=test.six"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	new := &Mapping{Default: rules, Rules: old.Rules[:1]}
+
+	added, removed := DiffMappings(old, new)
+	assert.Equal(t, []string{
+		"default: suffix test.one=test.three",
+		"default: suffix test.five=test.six",
+	}, added)
+	assert.Equal(t, []string{
+		"default: suffix test.one=test.two",
+		"preview: selector environment=preview",
+		"preview: suffix test.one=preview.test.two",
+		"preview: suffix test.three=preview.test.four",
+	}, removed)
+
+	added, removed = DiffMappings(old, old)
+	assert.Empty(t, added)
+	assert.Empty(t, removed)
+
+	added, removed = DiffMappings(nil, new)
+	assert.Len(t, added, 4)
+	assert.Empty(t, removed)
+}
+
+func TestCombineMappings(t *testing.T) {
+	first, err := LoadMapping(filepath.Join("testdata", "mapping.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := ParseRules([]string{"test.one=test.three"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := &Mapping{Default: rules, Rules: first.Rules[:1]}
+
+	combined := CombineMappings(first, nil, second)
+	assert.Equal(t, append(first.Default, second.Default...), combined.Default)
+	assert.Equal(t, append(first.Rules, second.Rules...), combined.Rules)
+	assert.Len(t, first.Default, 1, "mappings must not change")
+
+	assert.True(t, CombineMappings().Empty())
+}
@@ -3,19 +3,34 @@ package mutator
 import (
 	"encoding/json"
 	"fmt"
-	"regexp"
 	"strings"
 
 	admission "k8s.io/api/admission/v1"
-	networking "k8s.io/api/networking/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
 )
 
+// HostRewrittenReason is the reason of the events recorded for rewritten hosts
+const HostRewrittenReason = "HostRewritten"
+
 // Patch represents a JSON patch
 type Patch struct {
-	Op    string `json:"op"`
-	Path  string `json:"path"`
-	Value string `json:"value"`
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Change is a host rewritten within the value at Path
+type Change struct {
+	Path string
+	Old  string
+	New  string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s → %s", c.Old, c.New)
 }
 
 // BadRequest is used to allow the caller to return an appropriate http response
@@ -27,85 +42,235 @@ func (e *BadRequest) Error() string {
 	return fmt.Sprintf("Bad Request: %s", e.err)
 }
 
-// Mutate receives an http request body (AdmissionReview), and baseDomain.
-// It adds an AdmissionResponse to the AdmissionReview and then returns it.
-// Its goal is to create a JSON patch to append the baseDomain to the host
-// values in a given ingress resource
-func Mutate(body []byte, sourceDomains string, targetDomain string) ([]byte, error) {
-	// prevent an empty sourceDomains
-	if sourceDomains == "" {
-		return nil, fmt.Errorf("Received empty source domains")
-	}
+// Config holds the domain mapping used by Mutate
+type Config struct {
+	Mapping *Mapping
+
+	// AllowEmptyMapping leaves resources unchanged when the mapping is empty
+	// rather than failing, for mappings whose rules are yet to be created
+	AllowEmptyMapping bool
+
+	// NamespaceLabels is only required when the mapping selects namespaces
+	// by label
+	NamespaceLabels NamespaceLabels
+
+	// Annotations are the keys of annotations holding hosts separated by
+	// commas or spaces
+	Annotations []string
 
-	// prevent an empty targetDomain
-	if targetDomain == "" {
-		return nil, fmt.Errorf("Received empty target domain")
+	// DryRunPassthrough answers dry run requests with warnings describing
+	// the patches rather than the patches themselves
+	DryRunPassthrough bool
+
+	// Recorder records an event on the object for each host rewritten, no
+	// events are recorded when nil
+	Recorder record.EventRecorder
+}
+
+// Mutate receives an http request body (AdmissionReview), and the domain
+// mapping. It returns an AdmissionReview of the same version with an
+// AdmissionResponse. Its goal is to create a JSON patch to rewrite the host values
+// in a given resource, located by the handler registered for its kind and in
+// the configured annotations, with the rules the mapping selects for the
+// namespace of the request. Objects may opt out with the SkipAnnotation or
+// override the target domain with the TargetAnnotation. The original values of the rewritten fields are
+// recorded in the OriginalHostsAnnotation.
+func Mutate(body []byte, config *Config) ([]byte, error) {
+	// unmarshal the request of either AdmissionReview version
+	review, err := DecodeReview(body)
+	if err != nil {
+		return nil, err
 	}
 
-	// unmarshal the request
-	admReview := admission.AdmissionReview{}
-	if err := json.Unmarshal(body, &admReview); err != nil {
-		return nil, &BadRequest{fmt.Sprintf("Failed to unmarshal AdmissionReview: %s", err.Error())}
+	return MutateReview(review, config)
+}
+
+// MutateReview is Mutate for an AdmissionReview that has already been
+// decoded. Its request context decides how dry runs are answered, and updates
+// keep hosts the OriginalHostsAnnotation shows were already rewritten.
+func MutateReview(review *Review, config *Config) ([]byte, error) {
+	// prevent an empty mapping
+	if config == nil || (config.Mapping.Empty() && !config.AllowEmptyMapping) {
+		return nil, fmt.Errorf("Received empty domain mapping")
 	}
-	request := admReview.Request
 
-	// handle an empty request
-	if request == nil {
-		return nil, &BadRequest{"AdmissionReview.Request is nil"}
+	typeMeta, ctx := review.typeMeta, review.Context
+
+	// locate the hosts of the resource from the request
+	fields, object, supported, err := locateFields(review, config.Annotations)
+	if err != nil {
+		return nil, err
 	}
 
-	// get the ingress resource from the request
-	var ingress *networking.Ingress
-	if err := json.Unmarshal(request.Object.Raw, &ingress); err != nil {
-		return nil, &BadRequest{fmt.Sprintf("Failed to unmarshal ingress from AdmissionRequest: %s", err.Error())}
+	// select the rules for the namespace of the request
+	var rules []Rule
+	if config.Mapping != nil {
+		if rules, err = config.Mapping.Select(ctx.Namespace, config.NamespaceLabels); err != nil {
+			return nil, fmt.Errorf("Failed to select rules for namespace: %s", err)
+		}
 	}
 
 	// set the response options
 	response := &admission.AdmissionResponse{}
 	response.Allowed = true
-	response.UID = request.UID
-	patchType := admission.PatchTypeJSONPatch
-	response.PatchType = &patchType
-	response.AuditAnnotations = map[string]string{
-		"mutated-host": "true",
+	response.UID = ctx.UID
+
+	// set the result as success
+	response.Result = &metav1.Status{
+		Status: "Success",
+	}
+
+	// leave the resource unchanged when it is not supported, it opts out or
+	// no rules apply to its namespace
+	if !supported || skipObject(object.Annotations) || len(rules) == 0 {
+		return encodeReview(typeMeta, response)
 	}
 
-	// build a JSONPatch for each host rule
+	// apply the target domain the object asks for
+	rules = overrideTarget(rules, object.Annotations)
+
+	// build a JSONPatch for each field with hosts that change, skipping
+	// empty hosts, and record the original value of each field rewritten
+	existing := originalHosts(object.Annotations)
+	originals := map[string]string{}
+	var changes []Change
 	var patches []*Patch
-	for i, rule := range ingress.Spec.Rules {
+	for _, field := range fields {
+		if field.Value == "" {
+			continue
+		}
+
+		// keep a field rewritten by an earlier request as it is, so rules
+		// whose target matches their source are not applied twice
+		if original, ok := existing[field.Path]; ok && ctx.Operation == admission.Update {
+			previous := Field{Value: original, Rewrite: field.Rewrite}
+			if previous.rewrite(func(host string) string { return replaceDomain(host, rules) }) == field.Value {
+				originals[field.Path] = original
+				continue
+			}
+		}
+
+		replace := func(host string) string {
+			result := replaceDomain(host, rules)
+			if host != "" && result != host {
+				changes = append(changes, Change{Path: field.Path, Old: host, New: result})
+			}
+			return result
+		}
+
+		value := field.rewrite(replace)
+		if value == field.Value {
+			continue
+		}
+		originals[field.Path] = field.Value
+
 		patches = append(patches, &Patch{
 			Op:    "replace",
-			Path:  fmt.Sprintf("/spec/rules/%d/host", i),
-			Value: replaceDomain(rule.Host, strings.Split(sourceDomains, ","), targetDomain),
+			Path:  field.Path,
+			Value: value,
 		})
 	}
 
+	annotationPatch, err := originalHostsPatch(object.Annotations, originals)
+	if err != nil {
+		return nil, err
+	}
+
+	// leave the resource unchanged when no hosts change
+	if len(patches) == 0 && annotationPatch == nil {
+		return encodeReview(typeMeta, response)
+	}
+
+	// describe the patches instead of applying them to a dry run when asked
+	if ctx.DryRun && config.DryRunPassthrough {
+		for _, patch := range patches {
+			response.Warnings = append(response.Warnings, fmt.Sprintf("dry run: would %s %s with %v", patch.Op, patch.Path, patch.Value))
+		}
+		return encodeReview(typeMeta, response)
+	}
+
+	if annotationPatch != nil {
+		patches = append(patches, annotationPatch)
+	}
+
 	// add the patches to the response
 	jsonPatches, err := json.Marshal(patches)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to marshal patches to JSON: %s", err)
 	}
+	patchType := admission.PatchTypeJSONPatch
+	response.PatchType = &patchType
 	response.Patch = jsonPatches
+	if len(changes) > 0 {
+		response.AuditAnnotations = map[string]string{
+			"mutated-host":  "true",
+			"mutated-hosts": describeChanges(changes),
+		}
+	}
 
-	// set the result as success
-	response.Result = &metav1.Status{
-		Status: "Success",
+	// record the rewritten hosts on the object, dry runs are never persisted
+	if config.Recorder != nil && !ctx.DryRun {
+		ref := objectReference(ctx, object)
+		for _, change := range distinctChanges(changes) {
+			config.Recorder.Eventf(ref, corev1.EventTypeNormal, HostRewrittenReason, "Rewrote host %s", change)
+		}
 	}
 
-	// Add the response to the AdmissionReview and return it
-	admReview.Response = response
-	responseBody, err := json.Marshal(admReview)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to marshal AdmissionReview response to JSON: %s", err)
+	return encodeReview(typeMeta, response)
+}
+
+// distinctChanges returns the changes with each old and new host pair once
+func distinctChanges(changes []Change) []Change {
+	seen := map[Change]bool{}
+	var distinct []Change
+	for _, change := range changes {
+		key := Change{Old: change.Old, New: change.New}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		distinct = append(distinct, change)
+	}
+	return distinct
+}
+
+// describeChanges lists each distinct host change as old → new
+func describeChanges(changes []Change) string {
+	var descriptions []string
+	for _, change := range distinctChanges(changes) {
+		descriptions = append(descriptions, change.String())
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// objectReference refers to the object of the request. Objects being created
+// may only have a generated name and no UID yet.
+func objectReference(ctx RequestContext, object *metav1.PartialObjectMetadata) *corev1.ObjectReference {
+	ref := &corev1.ObjectReference{
+		APIVersion: schema.GroupVersion{Group: ctx.Kind.Group, Version: ctx.Kind.Version}.String(),
+		Kind:       ctx.Kind.Kind,
+		Namespace:  ctx.Namespace,
+		Name:       ctx.Name,
+		UID:        object.UID,
+	}
+	if ref.Name == "" {
+		ref.Name = object.Name
+	}
+	if ref.Name == "" {
+		ref.Name = object.GenerateName
 	}
-	return responseBody, nil
+	return ref
 }
 
-func replaceDomain(host string, sources []string, target string) string {
-	for _, suffix := range sources {
-		if strings.HasSuffix(host, suffix) {
-			re := regexp.MustCompile("." + suffix + "$")
-			result := re.ReplaceAllString(host, "$1."+target)
+// replaceDomain rewrites the host with the first rule matching it. A trailing
+// dot on the host is kept on the result.
+func replaceDomain(host string, rules []Rule) string {
+	name := strings.TrimSuffix(host, ".")
+	for i := range rules {
+		if result, ok := rules[i].replace(name); ok {
+			if name != host {
+				result += "."
+			}
 			return result
 		}
 	}
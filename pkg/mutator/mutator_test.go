@@ -9,6 +9,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 )
 
 func getTestData(t *testing.T, file string) []byte {
@@ -22,61 +24,357 @@ func getTestData(t *testing.T, file string) []byte {
 
 func TestMutate(t *testing.T) {
 	tc := []struct {
-		name          string
-		testdata      string
-		sourceDomains string
-		targetDomain  string
-		patches       []*Patch
-		err           bool
-		errType       interface{}
+		name        string
+		testdata    string
+		domains     []string
+		rules       []NamespaceRule
+		annotations []string
+		audit       string
+		passthrough bool
+		allowEmpty  bool
+		warnings    []string
+		events      []string
+		patches     []*Patch
+		err         bool
+		errType     interface{}
 	}{
 		{
-			name:          "valid request single rule",
-			testdata:      "valid-request-single-rule.json",
-			sourceDomains: "test.one",
-			targetDomain:  "test.two",
+			name:     "valid request single rule",
+			testdata: "valid-request-single-rule.json",
+			domains:  []string{"test.one=test.two"},
 			patches: []*Patch{
 				{"replace", "/spec/rules/0/host", "muting.test.two"},
+				{"add", "/metadata/annotations/muting.io~1original-hosts", "{\"/spec/rules/0/host\":\"muting.test.one\"}"},
 			},
 			err: false,
 		},
 		{
-			name:          "valid request multi rule",
-			testdata:      "valid-request-multi-rule.json",
-			sourceDomains: "test.one",
-			targetDomain:  "test.two",
+			name:     "valid request multi rule",
+			testdata: "valid-request-multi-rule.json",
+			domains:  []string{"test.one=test.two"},
 			patches: []*Patch{
 				{"replace", "/spec/rules/0/host", "muting-a.test.two"},
 				{"replace", "/spec/rules/1/host", "muting-b.test.two"},
+				{"add", "/metadata/annotations/muting.io~1original-hosts", "{\"/spec/rules/0/host\":\"muting-a.test.one\",\"/spec/rules/1/host\":\"muting-b.test.one\"}"},
+			},
+			audit: "muting-a.test.one → muting-a.test.two, muting-b.test.one → muting-b.test.two",
+			events: []string{
+				"Normal HostRewritten Rewrote host muting-a.test.one → muting-a.test.two",
+				"Normal HostRewritten Rewrote host muting-b.test.one → muting-b.test.two",
+			},
+			err: false,
+		},
+		{
+			name:     "valid request tls",
+			testdata: "valid-request-tls.json",
+			domains:  []string{"test.one=test.two"},
+			patches: []*Patch{
+				{"replace", "/spec/rules/0/host", "muting-a.test.two"},
+				{"replace", "/spec/rules/1/host", "muting-b.test.two"},
+				{"replace", "/spec/tls/0/hosts/0", "muting-a.test.two"},
+				{"replace", "/spec/tls/0/hosts/1", "muting-b.test.two"},
+				{"add", "/metadata/annotations/muting.io~1original-hosts", "{\"/spec/rules/0/host\":\"muting-a.test.one\",\"/spec/rules/1/host\":\"muting-b.test.one\",\"/spec/tls/0/hosts/0\":\"muting-a.test.one\",\"/spec/tls/0/hosts/1\":\"muting-b.test.one\"}"},
+			},
+			audit: "muting-a.test.one → muting-a.test.two, muting-b.test.one → muting-b.test.two",
+			err:   false,
+		},
+		{
+			name:     "valid request mixed tls",
+			testdata: "valid-request-mixed-tls.json",
+			domains:  []string{"test.one=test.two"},
+			patches: []*Patch{
+				{"replace", "/spec/rules/0/host", "muting-a.test.two"},
+				{"replace", "/spec/rules/1/host", "muting-b.test.two"},
+				{"replace", "/spec/rules/2/host", "muting-c.test.two"},
+				{"replace", "/spec/tls/0/hosts/0", "muting-a.test.two"},
+				{"replace", "/spec/tls/2/hosts/0", "muting-c.test.two"},
+				{"add", "/metadata/annotations/muting.io~1original-hosts", "{\"/spec/rules/0/host\":\"muting-a.test.one\",\"/spec/rules/1/host\":\"muting-b.test.one\",\"/spec/rules/2/host\":\"muting-c.test.one\",\"/spec/tls/0/hosts/0\":\"muting-a.test.one\",\"/spec/tls/2/hosts/0\":\"muting-c.test.one\"}"},
+			},
+			err: false,
+		},
+		{
+			name:     "valid request multiple mappings",
+			testdata: "valid-request-multi-rule.json",
+			domains:  []string{"test.nine=test.ten", "test.one=test.two", "one=test.three"},
+			patches: []*Patch{
+				{"replace", "/spec/rules/0/host", "muting-a.test.two"},
+				{"replace", "/spec/rules/1/host", "muting-b.test.two"},
+				{"add", "/metadata/annotations/muting.io~1original-hosts", "{\"/spec/rules/0/host\":\"muting-a.test.one\",\"/spec/rules/1/host\":\"muting-b.test.one\"}"},
+			},
+			err: false,
+		},
+		{
+			name:     "valid request virtual service",
+			testdata: "valid-request-virtualservice.json",
+			domains:  []string{"test.one=test.two"},
+			patches: []*Patch{
+				{"replace", "/spec/hosts/0", "muting-a.test.two"},
+				{"add", "/metadata/annotations/muting.io~1original-hosts", "{\"/spec/hosts/0\":\"muting-a.test.one\"}"},
+			},
+			err: false,
+		},
+		{
+			name:     "valid request istio gateway",
+			testdata: "valid-request-istio-gateway.json",
+			domains:  []string{"test.one=test.two"},
+			patches: []*Patch{
+				{"replace", "/spec/servers/0/hosts/0", "muting-a.test.two"},
+				{"replace", "/spec/servers/0/hosts/1", "default/muting-b.test.two"},
+				{"replace", "/spec/servers/1/hosts/0", "*/muting-c.test.two"},
+				{"add", "/metadata/annotations/muting.io~1original-hosts", "{\"/spec/servers/0/hosts/0\":\"muting-a.test.one\",\"/spec/servers/0/hosts/1\":\"default/muting-b.test.one\",\"/spec/servers/1/hosts/0\":\"*/muting-c.test.one\"}"},
+			},
+			err: false,
+		},
+		{
+			name:     "valid request http route",
+			testdata: "valid-request-httproute.json",
+			domains:  []string{"test.one=test.two"},
+			patches: []*Patch{
+				{"replace", "/spec/hostnames/0", "muting-a.test.two"},
+				{"replace", "/spec/hostnames/1", "*.muting-b.test.two"},
+				{"add", "/metadata/annotations/muting.io~1original-hosts", "{\"/spec/hostnames/0\":\"muting-a.test.one\",\"/spec/hostnames/1\":\"*.muting-b.test.one\"}"},
+			},
+			err: false,
+		},
+		{
+			name:     "valid request grpc route",
+			testdata: "valid-request-grpcroute.json",
+			domains:  []string{"test.one=test.two"},
+			patches: []*Patch{
+				{"replace", "/spec/hostnames/0", "muting.test.two"},
+				{"add", "/metadata/annotations/muting.io~1original-hosts", "{\"/spec/hostnames/0\":\"muting.test.one\"}"},
 			},
 			err: false,
 		},
 		{
-			name:          "invalid request empty AdmissionReview.Request",
-			testdata:      "invalid-request-empty-request.json",
-			sourceDomains: "test.one",
-			targetDomain:  "test.two",
-			patches:       []*Patch{},
-			err:           true,
-			errType:       &BadRequest{},
+			name:     "valid request tls route",
+			testdata: "valid-request-tlsroute.json",
+			domains:  []string{"test.one=test.two"},
+			patches: []*Patch{
+				{"replace", "/spec/hostnames/0", "muting.test.two"},
+				{"add", "/metadata/annotations/muting.io~1original-hosts", "{\"/spec/hostnames/0\":\"muting.test.one\"}"},
+			},
+			err: false,
 		},
 		{
-			name:          "invalid request invalid ingress",
-			testdata:      "invalid-request-empty-request.json",
-			sourceDomains: "test.one",
-			targetDomain:  "test.two",
-			patches:       []*Patch{},
-			err:           true,
-			errType:       &BadRequest{},
+			name:     "valid request gateway",
+			testdata: "valid-request-gateway.json",
+			domains:  []string{"test.one=test.two"},
+			patches: []*Patch{
+				{"replace", "/spec/listeners/1/hostname", "*.test.two"},
+				{"add", "/metadata/annotations/muting.io~1original-hosts", "{\"/spec/listeners/1/hostname\":\"*.test.one\"}"},
+			},
+			err: false,
 		},
 		{
-			name:          "invalid request json",
-			testdata:      "invalid-request-json.json",
-			sourceDomains: "test.one",
-			targetDomain:  "test.two",
-			patches:       []*Patch{},
-			err:           true,
-			errType:       &BadRequest{},
+			name:     "valid request openshift route",
+			testdata: "valid-request-openshift-route.json",
+			domains:  []string{"test.one=test.two"},
+			patches: []*Patch{
+				{"replace", "/spec/host", "muting.test.two"},
+				{"add", "/metadata/annotations/muting.io~1original-hosts", "{\"/spec/host\":\"muting.test.one\"}"},
+			},
+			err: false,
+		},
+		{
+			name:     "valid request traefik ingress route",
+			testdata: "valid-request-traefik-ingressroute.json",
+			domains:  []string{"test.one=test.two"},
+			patches: []*Patch{
+				{"replace", "/spec/routes/0/match", "Host(`muting-a.test.two`) && PathPrefix(`/a`)"},
+				{"replace", "/spec/tls/domains/0/main", "test.two"},
+				{"replace", "/spec/tls/domains/0/sans/0", "*.test.two"},
+				{"add", "/metadata/annotations/muting.io~1original-hosts", "{\"/spec/routes/0/match\":\"Host(`muting-a.test.one`) && PathPrefix(`/a`)\",\"/spec/tls/domains/0/main\":\"test.one\",\"/spec/tls/domains/0/sans/0\":\"*.test.one\"}"},
+			},
+			err: false,
+		},
+		{
+			name:     "valid request annotations",
+			testdata: "valid-request-annotations.json",
+			domains:  []string{"test.one=test.two"},
+			annotations: []string{
+				"external-dns.alpha.kubernetes.io/hostname",
+				"nginx.ingress.kubernetes.io/server-alias",
+				"cert-manager.io/common-name",
+				"muting.test/host~name",
+				"muting.test/missing",
+			},
+			patches: []*Patch{
+				{"replace", "/spec/rules/0/host", "muting.test.two"},
+				{"replace", "/metadata/annotations/external-dns.alpha.kubernetes.io~1hostname", "muting.test.two,muting-a.test.two"},
+				{"replace", "/metadata/annotations/nginx.ingress.kubernetes.io~1server-alias", "muting-b.test.two muting-c.test.three"},
+				{"replace", "/metadata/annotations/cert-manager.io~1common-name", "muting.test.two"},
+				{"replace", "/metadata/annotations/muting.test~1host~0name", "muting.test.two"},
+				{"add", "/metadata/annotations/muting.io~1original-hosts", "{\"/metadata/annotations/cert-manager.io~1common-name\":\"muting.test.one\",\"/metadata/annotations/external-dns.alpha.kubernetes.io~1hostname\":\"muting.test.one,muting-a.test.one\",\"/metadata/annotations/muting.test~1host~0name\":\"muting.test.one\",\"/metadata/annotations/nginx.ingress.kubernetes.io~1server-alias\":\"muting-b.test.one muting-c.test.three\",\"/spec/rules/0/host\":\"muting.test.one\"}"},
+			},
+			err: false,
+		},
+		{
+			name:     "valid request unsupported kind",
+			testdata: "valid-request-unsupported-kind.json",
+			domains:  []string{"test.one=test.two"},
+			err:      false,
+		},
+		{
+			name:     "valid request namespace rule",
+			testdata: "valid-request-single-rule.json",
+			domains:  []string{"test.one=test.two"},
+			rules: []NamespaceRule{
+				{
+					Namespaces: []string{"default"},
+					Domains:    []Rule{{Mode: SuffixMode, Source: "test.one", Target: "test.three"}},
+				},
+			},
+			patches: []*Patch{
+				{"replace", "/spec/rules/0/host", "muting.test.three"},
+				{"add", "/metadata/annotations/muting.io~1original-hosts", "{\"/spec/rules/0/host\":\"muting.test.one\"}"},
+			},
+			err: false,
+		},
+		{
+			name:     "valid request other namespace rule",
+			testdata: "valid-request-single-rule.json",
+			domains:  []string{"test.one=test.two"},
+			rules: []NamespaceRule{
+				{
+					Namespaces: []string{"other"},
+					Domains:    []Rule{{Mode: SuffixMode, Source: "test.one", Target: "test.three"}},
+				},
+			},
+			patches: []*Patch{
+				{"replace", "/spec/rules/0/host", "muting.test.two"},
+				{"add", "/metadata/annotations/muting.io~1original-hosts", "{\"/spec/rules/0/host\":\"muting.test.one\"}"},
+			},
+			err: false,
+		},
+		{
+			name:     "valid request unchanged hosts",
+			testdata: "valid-request-unchanged-hosts.json",
+			domains:  []string{"test.one=test.two"},
+			patches: []*Patch{
+				{"replace", "/spec/rules/2/host", "muting-c.test.two"},
+				{"replace", "/spec/tls/0/hosts/1", "muting-c.test.two"},
+				{"add", "/metadata/annotations/muting.io~1original-hosts", "{\"/spec/rules/2/host\":\"muting-c.test.one\",\"/spec/tls/0/hosts/1\":\"muting-c.test.one\"}"},
+			},
+			audit: "muting-c.test.one → muting-c.test.two",
+			err:   false,
+		},
+		{
+			name:     "valid request update",
+			testdata: "valid-request-update.json",
+			domains:  []string{"test.one=dev.test.one"},
+			patches: []*Patch{
+				{"replace", "/spec/rules/1/host", "muting-b.dev.test.one"},
+				{"add", "/metadata/annotations/muting.io~1original-hosts", "{\"/spec/rules/0/host\":\"muting-a.test.one\",\"/spec/rules/1/host\":\"muting-b.test.one\"}"},
+			},
+			audit: "muting-b.test.one → muting-b.dev.test.one",
+			err:   false,
+		},
+		{
+			name:     "valid request update already mutated",
+			testdata: "valid-request-update-mutated.json",
+			domains:  []string{"test.one=dev.test.one"},
+			err:      false,
+		},
+		{
+			name:     "valid request skip",
+			testdata: "valid-request-skip.json",
+			domains:  []string{"test.one=test.two"},
+			err:      false,
+		},
+		{
+			name:     "valid request target",
+			testdata: "valid-request-target.json",
+			domains:  []string{"*.test.nine=*.test.ten", "test.one=test.two"},
+			patches: []*Patch{
+				{"replace", "/spec/rules/0/host", "muting-a.test.override"},
+				{"replace", "/spec/rules/1/host", "muting-b.test.override"},
+				{"replace", "/spec/tls/0/hosts/0", "muting-a.test.override"},
+				{"replace", "/spec/tls/0/hosts/1", "muting-b.test.override"},
+				{"add", "/metadata/annotations/muting.io~1original-hosts", "{\"/spec/rules/0/host\":\"muting-a.test.one\",\"/spec/rules/1/host\":\"muting-b.test.one\",\"/spec/tls/0/hosts/0\":\"muting-a.test.one\",\"/spec/tls/0/hosts/1\":\"muting-b.test.one\"}"},
+			},
+			audit: "muting-a.test.one → muting-a.test.override, muting-b.test.one → muting-b.test.override",
+			err:   false,
+		},
+		{
+			name:     "valid request no changes",
+			testdata: "valid-request-no-changes.json",
+			domains:  []string{"test.one=test.two"},
+			err:      false,
+		},
+		{
+			name:     "valid request dry run",
+			testdata: "valid-request-dry-run.json",
+			domains:  []string{"test.one=test.two"},
+			patches: []*Patch{
+				{"replace", "/spec/rules/0/host", "muting.test.two"},
+				{"add", "/metadata/annotations/muting.io~1original-hosts", "{\"/spec/rules/0/host\":\"muting.test.one\"}"},
+			},
+			events: []string{},
+			err:    false,
+		},
+		{
+			name:        "valid request dry run passthrough",
+			testdata:    "valid-request-dry-run.json",
+			domains:     []string{"test.one=test.two"},
+			passthrough: true,
+			warnings: []string{
+				"dry run: would replace /spec/rules/0/host with muting.test.two",
+			},
+			err: false,
+		},
+		{
+			name:        "valid request passthrough without dry run",
+			testdata:    "valid-request-single-rule.json",
+			domains:     []string{"test.one=test.two"},
+			passthrough: true,
+			patches: []*Patch{
+				{"replace", "/spec/rules/0/host", "muting.test.two"},
+				{"add", "/metadata/annotations/muting.io~1original-hosts", "{\"/spec/rules/0/host\":\"muting.test.one\"}"},
+			},
+			err: false,
+		},
+		{
+			name:     "valid request v1beta1",
+			testdata: "valid-request-v1beta1.json",
+			domains:  []string{"test.one=test.two"},
+			patches: []*Patch{
+				{"replace", "/spec/rules/0/host", "muting.test.two"},
+				{"add", "/metadata/annotations/muting.io~1original-hosts", "{\"/spec/rules/0/host\":\"muting.test.one\"}"},
+			},
+			err: false,
+		},
+		{
+			name:     "invalid request unsupported version",
+			testdata: "invalid-request-version.json",
+			domains:  []string{"test.one=test.two"},
+			patches:  []*Patch{},
+			err:      true,
+			errType:  &BadRequest{},
+		},
+		{
+			name:     "invalid request empty AdmissionReview.Request",
+			testdata: "invalid-request-empty-request.json",
+			domains:  []string{"test.one=test.two"},
+			patches:  []*Patch{},
+			err:      true,
+			errType:  &BadRequest{},
+		},
+		{
+			name:     "invalid request invalid ingress",
+			testdata: "invalid-request-empty-request.json",
+			domains:  []string{"test.one=test.two"},
+			patches:  []*Patch{},
+			err:      true,
+			errType:  &BadRequest{},
+		},
+		{
+			name:     "invalid request json",
+			testdata: "invalid-request-json.json",
+			domains:  []string{"test.one=test.two"},
+			patches:  []*Patch{},
+			err:      true,
+			errType:  &BadRequest{},
 		},
 		{
 			name:     "empty base domain",
@@ -85,13 +383,37 @@ func TestMutate(t *testing.T) {
 			err:      true,
 			errType:  errors.New(""),
 		},
+		{
+			name:       "empty base domain allowed",
+			testdata:   "valid-request-single-rule.json",
+			allowEmpty: true,
+			err:        false,
+		},
 	}
 
 	for _, test := range tc {
 		t.Run(test.name, func(t *testing.T) {
 			// execute the test
 			request := getTestData(t, test.testdata)
-			respBody, err := Mutate(request, test.sourceDomains, test.targetDomain)
+			rules, err := ParseRules(test.domains)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mapping := &Mapping{
+				Default: rules,
+				Rules:   test.rules,
+			}
+			if err := mapping.Compile(); err != nil {
+				t.Fatal(err)
+			}
+			recorder := record.NewFakeRecorder(10)
+			respBody, err := Mutate(request, &Config{
+				Mapping:           mapping,
+				Annotations:       test.annotations,
+				AllowEmptyMapping: test.allowEmpty,
+				DryRunPassthrough: test.passthrough,
+				Recorder:          recorder,
+			})
 
 			// validate error if error expected
 			if test.err {
@@ -109,13 +431,65 @@ func TestMutate(t *testing.T) {
 			admReview := v1.AdmissionReview{}
 			err = json.Unmarshal(respBody, &admReview)
 			assert.NoError(t, err)
+			requestReview := metav1.TypeMeta{}
+			if err := json.Unmarshal(request, &requestReview); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, requestReview.APIVersion, admReview.APIVersion)
 			resp := admReview.Response
+			assert.Equal(t, test.warnings, resp.Warnings)
+			if test.patches == nil {
+				assert.Nil(t, resp.PatchType)
+				assert.Empty(t, resp.Patch)
+				return
+			}
 			expectedPatch, err := json.Marshal(test.patches)
 			if err != nil {
 				t.Fatal(err)
 			}
 			assert.Equal(t, string(expectedPatch), string(resp.Patch))
 			assert.Equal(t, resp.AuditAnnotations["mutated-host"], "true")
+			if test.audit != "" {
+				assert.Equal(t, test.audit, resp.AuditAnnotations["mutated-hosts"])
+			}
+			if test.events != nil {
+				close(recorder.Events)
+				events := []string{}
+				for event := range recorder.Events {
+					events = append(events, event)
+				}
+				assert.Equal(t, test.events, events)
+			}
+		})
+	}
+}
+
+func TestReplaceDomain(t *testing.T) {
+	rules, err := ParseRules([]string{"example.org=example.com", "other.net.=other.io."})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tc := []struct {
+		name string
+		host string
+		want string
+	}{
+		{"subdomain", "muting.example.org", "muting.example.com"},
+		{"nested subdomain", "a.b.example.org", "a.b.example.com"},
+		{"equal to source", "example.org", "example.com"},
+		{"partial label", "badexample.org", "badexample.org"},
+		{"dot is not a wildcard", "muting.exampleXorg", "muting.exampleXorg"},
+		{"case insensitive", "Muting.Example.ORG", "Muting.example.com"},
+		{"trailing dot", "muting.example.org.", "muting.example.com."},
+		{"source with trailing dot", "muting.other.net", "muting.other.io"},
+		{"no match", "muting.example.net", "muting.example.net"},
+		{"empty", "", ""},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, replaceDomain(test.host, rules))
 		})
 	}
 }
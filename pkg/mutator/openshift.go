@@ -0,0 +1,34 @@
+package mutator
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// OpenShiftRouteGroup is the API group of OpenShift routes
+const OpenShiftRouteGroup = "route.openshift.io"
+
+func init() {
+	RegisterHandler(schema.GroupKind{Group: OpenShiftRouteGroup, Kind: "Route"}, openShiftRouteHandler)
+}
+
+// openShiftRouteHandler locates the host of an OpenShift route. Routes
+// without a host have one generated by the router and are skipped.
+func openShiftRouteHandler(object []byte) ([]Field, error) {
+	obj, err := decodeUnstructured(object)
+	if err != nil {
+		return nil, err
+	}
+
+	host, found, err := unstructured.NestedString(obj, "spec", "host")
+	if err != nil {
+		return nil, fmt.Errorf("invalid spec.host: %w", err)
+	}
+	if !found {
+		return nil, nil
+	}
+
+	return []Field{{Path: "/spec/host", Value: host}}, nil
+}
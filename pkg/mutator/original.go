@@ -0,0 +1,70 @@
+package mutator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// OriginalHostsAnnotation records the values of the fields as they were
+// before their hosts were rewritten, as a JSON map keyed by the JSON Pointer
+// path each field is patched at, for example
+// {"/spec/rules/0/host":"app.example.org"}. Paths cover TLS hosts,
+// annotations and the fields of other resources as well as ingress rules.
+// As a path holds the index of its rule, a recorded value is stale once the
+// rules are reordered: it no longer rewrites to the field at its path, so
+// that field is rewritten as a new one.
+const OriginalHostsAnnotation = "muting.io/original-hosts"
+
+// originalHosts returns the values recorded by the original hosts annotation.
+// An annotation that cannot be decoded is ignored and later replaced.
+func originalHosts(annotations map[string]string) map[string]string {
+	value, ok := annotations[OriginalHostsAnnotation]
+	if !ok {
+		return nil
+	}
+
+	var originals map[string]string
+	if err := json.Unmarshal([]byte(value), &originals); err != nil {
+		return nil
+	}
+	return originals
+}
+
+// originalHostsPatch returns the patch recording the original values in the
+// annotation, or nil when the annotation already records them
+func originalHostsPatch(annotations map[string]string, originals map[string]string) (*Patch, error) {
+	path := "/metadata/annotations/" + escapeJSONPointer(OriginalHostsAnnotation)
+	current, ok := annotations[OriginalHostsAnnotation]
+
+	if len(originals) == 0 {
+		if !ok {
+			return nil, nil
+		}
+		return &Patch{Op: "remove", Path: path}, nil
+	}
+
+	// hosts within rules such as Host(`a`) && Path(`/`) are kept readable
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(originals); err != nil {
+		return nil, fmt.Errorf("Failed to marshal original hosts to JSON: %s", err)
+	}
+	value := strings.TrimSuffix(buf.String(), "\n")
+	if ok && current == value {
+		return nil, nil
+	}
+
+	// the annotations must be added as a whole when the object has none
+	if annotations == nil {
+		return &Patch{
+			Op:    "add",
+			Path:  "/metadata/annotations",
+			Value: map[string]string{OriginalHostsAnnotation: value},
+		}, nil
+	}
+
+	return &Patch{Op: "add", Path: path, Value: value}, nil
+}
@@ -0,0 +1,58 @@
+package mutator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOriginalHosts(t *testing.T) {
+	assert.Equal(t, map[string]string{"/spec/host": "a.org"}, originalHosts(map[string]string{OriginalHostsAnnotation: `{"/spec/host":"a.org"}`}))
+	assert.Nil(t, originalHosts(map[string]string{OriginalHostsAnnotation: "a.org"}))
+	assert.Nil(t, originalHosts(nil))
+}
+
+func TestOriginalHostsPatch(t *testing.T) {
+	originals := map[string]string{"/spec/routes/0/match": "Host(`a.org`) && Path(`/`)"}
+	recorded := `{"/spec/routes/0/match":"Host(` + "`a.org`" + `) && Path(` + "`/`" + `)"}`
+
+	tc := []struct {
+		name        string
+		annotations map[string]string
+		originals   map[string]string
+		want        *Patch
+	}{
+		{
+			name:      "no annotations",
+			originals: originals,
+			want:      &Patch{"add", "/metadata/annotations", map[string]string{OriginalHostsAnnotation: recorded}},
+		},
+		{
+			name:        "other annotations",
+			annotations: map[string]string{"a": "b"},
+			originals:   originals,
+			want:        &Patch{"add", "/metadata/annotations/muting.io~1original-hosts", recorded},
+		},
+		{
+			name:        "already recorded",
+			annotations: map[string]string{OriginalHostsAnnotation: recorded},
+			originals:   originals,
+		},
+		{
+			name:        "nothing rewritten",
+			annotations: map[string]string{OriginalHostsAnnotation: recorded},
+			want:        &Patch{Op: "remove", Path: "/metadata/annotations/muting.io~1original-hosts"},
+		},
+		{
+			name: "nothing recorded",
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			patch, err := originalHostsPatch(test.annotations, test.originals)
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, patch)
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package mutator
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	// SkipAnnotation leaves the object unchanged when it is true
+	SkipAnnotation = "muting.io/skip"
+	// TargetAnnotation overrides the target domain of the suffix rules for
+	// the object
+	TargetAnnotation = "muting.io/target"
+)
+
+// skipObject reports whether the annotations opt the object out of mutation
+func skipObject(annotations map[string]string) bool {
+	skip, err := strconv.ParseBool(annotations[SkipAnnotation])
+	return err == nil && skip
+}
+
+// overrideTarget returns the rules with the target domain of the suffix rules
+// replaced by the one the annotations set. Wildcard and regex rules build
+// their targets from the host and are kept as they are.
+func overrideTarget(rules []Rule, annotations map[string]string) []Rule {
+	target := strings.TrimSpace(annotations[TargetAnnotation])
+	if target == "" {
+		return rules
+	}
+
+	overridden := make([]Rule, len(rules))
+	copy(overridden, rules)
+	for i := range overridden {
+		if overridden[i].Mode == SuffixMode {
+			overridden[i].Target = target
+		}
+	}
+	return overridden
+}
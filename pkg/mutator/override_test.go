@@ -0,0 +1,40 @@
+package mutator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSkipObject(t *testing.T) {
+	tc := []struct {
+		value string
+		want  bool
+	}{
+		{"true", true},
+		{"True", true},
+		{"1", true},
+		{"false", false},
+		{"", false},
+		{"yes", false},
+	}
+
+	for _, test := range tc {
+		assert.Equal(t, test.want, skipObject(map[string]string{SkipAnnotation: test.value}), test.value)
+	}
+	assert.False(t, skipObject(nil))
+}
+
+func TestOverrideTarget(t *testing.T) {
+	rules, err := ParseRules([]string{"*.test.nine=*.test.ten", "test.one=test.two"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	overridden := overrideTarget(rules, map[string]string{TargetAnnotation: " test.override "})
+	assert.Equal(t, "*.test.ten", overridden[0].Target)
+	assert.Equal(t, "test.override", overridden[1].Target)
+	assert.Equal(t, "test.two", rules[1].Target, "rules of the mapping must not change")
+
+	assert.Equal(t, rules, overrideTarget(rules, map[string]string{}))
+}
@@ -0,0 +1,175 @@
+package mutator
+
+import (
+	"encoding/json"
+	"fmt"
+
+	admission "k8s.io/api/admission/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// SupportedReviewVersions are the AdmissionReview versions Mutate accepts
+var SupportedReviewVersions = []string{
+	admission.SchemeGroupVersion.Version,
+	admissionv1beta1.SchemeGroupVersion.Version,
+}
+
+// RequestContext describes the admission request being mutated
+type RequestContext struct {
+	UID       types.UID
+	Kind      metav1.GroupVersionKind
+	Namespace string
+	Name      string
+	Operation admission.Operation
+	User      string
+	DryRun    bool
+}
+
+// Review is a decoded AdmissionReview of any supported version
+type Review struct {
+	// Context describes the request of the review
+	Context RequestContext
+
+	typeMeta metav1.TypeMeta
+	request  *admission.AdmissionRequest
+}
+
+// DecodeReview decodes an AdmissionReview of any supported version, which
+// must hold a request with an object
+func DecodeReview(body []byte) (*Review, error) {
+	request, typeMeta, err := decodeReview(body)
+	if err != nil {
+		return nil, err
+	}
+
+	// handle an empty request
+	if request == nil {
+		return nil, &BadRequest{"AdmissionReview.Request is nil"}
+	}
+
+	// handle a request without an object
+	if len(request.Object.Raw) == 0 {
+		return nil, &BadRequest{"AdmissionRequest.Object is empty"}
+	}
+
+	review := &Review{
+		Context: RequestContext{
+			UID:       request.UID,
+			Kind:      request.Kind,
+			Namespace: request.Namespace,
+			Name:      request.Name,
+			Operation: request.Operation,
+			User:      request.UserInfo.Username,
+		},
+		typeMeta: typeMeta,
+		request:  request,
+	}
+	if request.DryRun != nil {
+		review.Context.DryRun = *request.DryRun
+	}
+
+	return review, nil
+}
+
+// Respond returns an AdmissionReview with the response in the version the
+// review was sent in
+func (r *Review) Respond(response *admission.AdmissionResponse) ([]byte, error) {
+	return encodeReview(r.typeMeta, response)
+}
+
+// decodeReview decodes an AdmissionReview of any supported version, returning
+// its request as admission/v1 along with the version it was sent in
+func decodeReview(body []byte) (*admission.AdmissionRequest, metav1.TypeMeta, error) {
+	var typeMeta metav1.TypeMeta
+	if err := json.Unmarshal(body, &typeMeta); err != nil {
+		return nil, typeMeta, &BadRequest{fmt.Sprintf("Failed to unmarshal AdmissionReview: %s", err.Error())}
+	}
+
+	switch typeMeta.APIVersion {
+	case admission.SchemeGroupVersion.String():
+		admReview := admission.AdmissionReview{}
+		if err := json.Unmarshal(body, &admReview); err != nil {
+			return nil, typeMeta, &BadRequest{fmt.Sprintf("Failed to unmarshal AdmissionReview: %s", err.Error())}
+		}
+		return admReview.Request, typeMeta, nil
+	case admissionv1beta1.SchemeGroupVersion.String():
+		admReview := admissionv1beta1.AdmissionReview{}
+		if err := json.Unmarshal(body, &admReview); err != nil {
+			return nil, typeMeta, &BadRequest{fmt.Sprintf("Failed to unmarshal AdmissionReview: %s", err.Error())}
+		}
+		return convertRequest(admReview.Request), typeMeta, nil
+	default:
+		return nil, typeMeta, &BadRequest{fmt.Sprintf("Unsupported AdmissionReview apiVersion: %q", typeMeta.APIVersion)}
+	}
+}
+
+// encodeReview returns an AdmissionReview with the response in the version
+// the request was sent in
+func encodeReview(typeMeta metav1.TypeMeta, response *admission.AdmissionResponse) ([]byte, error) {
+	var admReview interface{}
+
+	switch typeMeta.APIVersion {
+	case admissionv1beta1.SchemeGroupVersion.String():
+		admReview = admissionv1beta1.AdmissionReview{
+			TypeMeta: typeMeta,
+			Response: convertResponse(response),
+		}
+	default:
+		admReview = admission.AdmissionReview{
+			TypeMeta: typeMeta,
+			Response: response,
+		}
+	}
+
+	responseBody, err := json.Marshal(admReview)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal AdmissionReview response to JSON: %s", err)
+	}
+	return responseBody, nil
+}
+
+// convertRequest converts an admission/v1beta1 request to admission/v1
+func convertRequest(in *admissionv1beta1.AdmissionRequest) *admission.AdmissionRequest {
+	if in == nil {
+		return nil
+	}
+
+	return &admission.AdmissionRequest{
+		UID:                in.UID,
+		Kind:               in.Kind,
+		Resource:           in.Resource,
+		SubResource:        in.SubResource,
+		RequestKind:        in.RequestKind,
+		RequestResource:    in.RequestResource,
+		RequestSubResource: in.RequestSubResource,
+		Name:               in.Name,
+		Namespace:          in.Namespace,
+		Operation:          admission.Operation(in.Operation),
+		UserInfo:           in.UserInfo,
+		Object:             in.Object,
+		OldObject:          in.OldObject,
+		DryRun:             in.DryRun,
+		Options:            in.Options,
+	}
+}
+
+// convertResponse converts an admission/v1 response to admission/v1beta1
+func convertResponse(in *admission.AdmissionResponse) *admissionv1beta1.AdmissionResponse {
+	out := &admissionv1beta1.AdmissionResponse{
+		UID:              in.UID,
+		Allowed:          in.Allowed,
+		Result:           in.Result,
+		Patch:            in.Patch,
+		AuditAnnotations: in.AuditAnnotations,
+		Warnings:         in.Warnings,
+	}
+
+	if in.PatchType != nil {
+		patchType := admissionv1beta1.PatchType(*in.PatchType)
+		out.PatchType = &patchType
+	}
+
+	return out
+}
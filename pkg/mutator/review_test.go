@@ -0,0 +1,28 @@
+package mutator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admission "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDecodeReview(t *testing.T) {
+	review, err := DecodeReview(getTestData(t, "valid-request-dry-run.json"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, RequestContext{
+		UID:       "67f7e98f-0dec-11ea-8d4c-025000000001",
+		Kind:      metav1.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress"},
+		Namespace: "default",
+		Operation: admission.Create,
+		User:      "muting",
+		DryRun:    true,
+	}, review.Context)
+
+	_, err = DecodeReview(getTestData(t, "invalid-request-empty-request.json"))
+	assert.IsType(t, &BadRequest{}, err)
+}
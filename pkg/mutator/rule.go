@@ -0,0 +1,210 @@
+package mutator
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RuleMode selects how a rule matches hosts
+type RuleMode string
+
+const (
+	// SuffixMode matches the source domain and its subdomains
+	SuffixMode RuleMode = "suffix"
+	// WildcardMode matches a single DNS label for each * in the source
+	WildcardMode RuleMode = "wildcard"
+	// RegexMode matches an anchored regular expression, the target may
+	// reference its capture groups
+	RegexMode RuleMode = "regex"
+)
+
+// Rule rewrites hosts matching the Source to the Target. When no mode is
+// given it is detected from the source: a leading ^ is a regex, a * label is
+// a wildcard and anything else is a suffix.
+type Rule struct {
+	Mode   RuleMode `json:"mode,omitempty"`
+	Source string   `json:"source"`
+	Target string   `json:"target"`
+
+	re       *regexp.Regexp
+	template string
+}
+
+// ParseRules parses an ordered list of source=target rules
+func ParseRules(pairs []string) ([]Rule, error) {
+	var rules []Rule
+	for _, pair := range pairs {
+		source, target, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("ParseRules: mapping %q is not in the form source=target", pair)
+		}
+		rules = append(rules, Rule{
+			Source: strings.TrimSpace(source),
+			Target: strings.TrimSpace(target),
+		})
+	}
+
+	if err := compileRules(rules); err != nil {
+		return nil, fmt.Errorf("ParseRules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// Compile validates the rule and prepares the expression used by wildcard
+// and regex rules. It must be called before the rule is used.
+func (r *Rule) Compile() error {
+	if r.Source == "" {
+		return fmt.Errorf("empty source domain")
+	}
+	if r.Target == "" {
+		return fmt.Errorf("empty target domain for source %s", r.Source)
+	}
+
+	if r.Mode == "" {
+		r.Mode = detectMode(r.Source)
+	}
+
+	switch r.Mode {
+	case SuffixMode:
+		return nil
+	case WildcardMode:
+		return r.compileWildcard()
+	case RegexMode:
+		return r.compileRegex()
+	default:
+		return fmt.Errorf("unknown mode %q for source %s", r.Mode, r.Source)
+	}
+}
+
+// String describes the rule
+func (r Rule) String() string {
+	return fmt.Sprintf("%s %s=%s", r.Mode, r.Source, r.Target)
+}
+
+// replace returns the rewritten host and whether the rule matched it. The
+// host must not have a trailing dot.
+func (r *Rule) replace(host string) (string, bool) {
+	switch r.Mode {
+	case SuffixMode:
+		prefix, ok := matchDomain(host, r.Source)
+		if !ok {
+			return host, false
+		}
+		return prefix + strings.TrimSuffix(r.Target, "."), true
+	case WildcardMode, RegexMode:
+		if r.re == nil {
+			return host, false
+		}
+		match := r.re.FindStringSubmatchIndex(host)
+		if match == nil {
+			return host, false
+		}
+		return string(r.re.ExpandString(nil, r.template, host, match)), true
+	}
+	return host, false
+}
+
+func (r *Rule) compileWildcard() error {
+	source := strings.Split(strings.TrimSuffix(r.Source, "."), ".")
+	target := strings.Split(strings.TrimSuffix(r.Target, "."), ".")
+
+	var pattern, template []string
+	wildcards := 0
+	for _, label := range source {
+		switch {
+		case label == "*":
+			wildcards++
+			pattern = append(pattern, `([^.]+)`)
+		case strings.Contains(label, "*"):
+			return fmt.Errorf("wildcard source %s must use * as a whole label", r.Source)
+		default:
+			pattern = append(pattern, regexp.QuoteMeta(label))
+		}
+	}
+
+	group := 0
+	for _, label := range target {
+		switch {
+		case label == "*":
+			group++
+			if group > wildcards {
+				return fmt.Errorf("wildcard target %s has more wildcards than source %s", r.Target, r.Source)
+			}
+			template = append(template, fmt.Sprintf("${%d}", group))
+		case strings.Contains(label, "*"):
+			return fmt.Errorf("wildcard target %s must use * as a whole label", r.Target)
+		default:
+			template = append(template, strings.ReplaceAll(label, "$", "$$"))
+		}
+	}
+
+	re, err := regexp.Compile(`(?i)^` + strings.Join(pattern, `\.`) + `$`)
+	if err != nil {
+		return fmt.Errorf("invalid wildcard source %s: %w", r.Source, err)
+	}
+
+	r.re = re
+	r.template = strings.Join(template, ".")
+	return nil
+}
+
+func (r *Rule) compileRegex() error {
+	re, err := regexp.Compile(`(?i)^(?:` + r.Source + `)$`)
+	if err != nil {
+		return fmt.Errorf("invalid regex source %s: %w", r.Source, err)
+	}
+
+	r.re = re
+	r.template = r.Target
+	return nil
+}
+
+func detectMode(source string) RuleMode {
+	switch {
+	case strings.HasPrefix(source, "^"):
+		return RegexMode
+	case strings.Contains(source, "*"):
+		return WildcardMode
+	default:
+		return SuffixMode
+	}
+}
+
+func compileRules(rules []Rule) error {
+	for i := range rules {
+		if err := rules[i].Compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InDomain reports whether the host is the domain or one of its subdomains,
+// ignoring case and a trailing dot on the host
+func InDomain(host string, domain string) bool {
+	_, ok := matchDomain(strings.TrimSuffix(host, "."), domain)
+	return ok
+}
+
+// matchDomain reports whether the host is the domain or one of its
+// subdomains, returning the labels preceding the domain with their
+// trailing dot.
+func matchDomain(host string, domain string) (string, bool) {
+	domain = strings.TrimSuffix(domain, ".")
+	if domain == "" || len(host) < len(domain) {
+		return "", false
+	}
+
+	prefix, suffix := host[:len(host)-len(domain)], host[len(host)-len(domain):]
+	if !strings.EqualFold(suffix, domain) {
+		return "", false
+	}
+
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		return "", false
+	}
+
+	return prefix, true
+}
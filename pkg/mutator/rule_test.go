@@ -0,0 +1,126 @@
+package mutator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules([]string{
+		"a.org=a.com",
+		" b.org = b.net ",
+		"*.staging.example.org=*.stg.example.com",
+		`^(.+)-pr(\d+)\.example\.org$=$1.pr$2.preview.example.com`,
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, rules, 4) {
+		assert.Equal(t, "suffix a.org=a.com", rules[0].String())
+		assert.Equal(t, "suffix b.org=b.net", rules[1].String())
+		assert.Equal(t, WildcardMode, rules[2].Mode)
+		assert.Equal(t, RegexMode, rules[3].Mode)
+	}
+
+	for _, invalid := range []string{
+		"a.org",
+		"=a.com",
+		"a.org=",
+		"a*.example.org=a.example.com",
+		"*.example.org=*.*.example.com",
+		"*.example.org=*-a.example.com",
+		"^(.+.example.org=example.com",
+	} {
+		_, err := ParseRules([]string{invalid})
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRuleReplace(t *testing.T) {
+	tc := []struct {
+		name  string
+		rule  Rule
+		host  string
+		want  string
+		match bool
+	}{
+		{
+			name:  "suffix",
+			rule:  Rule{Mode: SuffixMode, Source: "example.org", Target: "example.com"},
+			host:  "a.b.example.org",
+			want:  "a.b.example.com",
+			match: true,
+		},
+		{
+			name: "suffix no match",
+			rule: Rule{Mode: SuffixMode, Source: "example.org", Target: "example.com"},
+			host: "badexample.org",
+			want: "badexample.org",
+		},
+		{
+			name:  "wildcard",
+			rule:  Rule{Source: "*.staging.example.org", Target: "*.stg.example.com"},
+			host:  "muting.staging.example.org",
+			want:  "muting.stg.example.com",
+			match: true,
+		},
+		{
+			name:  "wildcard literal",
+			rule:  Rule{Source: "*.staging.example.org", Target: "*.stg.example.com"},
+			host:  "*.staging.example.org",
+			want:  "*.stg.example.com",
+			match: true,
+		},
+		{
+			name:  "wildcard multiple",
+			rule:  Rule{Source: "*.*.example.org", Target: "*.*.example.com"},
+			host:  "a.B.Example.org",
+			want:  "a.B.example.com",
+			match: true,
+		},
+		{
+			name: "wildcard single label only",
+			rule: Rule{Source: "*.staging.example.org", Target: "*.stg.example.com"},
+			host: "a.b.staging.example.org",
+			want: "a.b.staging.example.org",
+		},
+		{
+			name: "wildcard dot is literal",
+			rule: Rule{Source: "*.staging.example.org", Target: "*.stg.example.com"},
+			host: "a.stagingXexample.org",
+			want: "a.stagingXexample.org",
+		},
+		{
+			name:  "regex",
+			rule:  Rule{Source: `^(.+)-pr(\d+)\.example\.org$`, Target: "$1.pr$2.preview.example.com"},
+			host:  "muting-pr42.example.org",
+			want:  "muting.pr42.preview.example.com",
+			match: true,
+		},
+		{
+			name: "regex anchored",
+			rule: Rule{Mode: RegexMode, Source: `(.+)-pr(\d+)\.example\.org`, Target: "$1.pr$2.preview.example.com"},
+			host: "muting-pr42.example.org.evil.net",
+			want: "muting-pr42.example.org.evil.net",
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			rule := test.rule
+			if !assert.NoError(t, rule.Compile()) {
+				t.FailNow()
+			}
+			got, match := rule.replace(test.host)
+			assert.Equal(t, test.want, got)
+			assert.Equal(t, test.match, match)
+		})
+	}
+}
+
+func TestInDomain(t *testing.T) {
+	assert.True(t, InDomain("example.org", "example.org"))
+	assert.True(t, InDomain("muting.Example.org.", "example.org"))
+	assert.True(t, InDomain("*.example.org", "example.org."))
+	assert.False(t, InDomain("badexample.org", "example.org"))
+	assert.False(t, InDomain("example.org.evil.net", "example.org"))
+}
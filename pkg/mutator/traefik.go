@@ -0,0 +1,204 @@
+package mutator
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// TraefikGroups are the API groups of Traefik resources, traefik.io since
+// Traefik 3 and traefik.containo.us before
+var TraefikGroups = []string{"traefik.io", "traefik.containo.us"}
+
+func init() {
+	for _, group := range TraefikGroups {
+		RegisterHandler(schema.GroupKind{Group: group, Kind: "IngressRoute"}, traefikHandler)
+		RegisterHandler(schema.GroupKind{Group: group, Kind: "IngressRouteTCP"}, traefikHandler)
+	}
+}
+
+// traefikHandler locates the hosts of a Traefik IngressRoute or
+// IngressRouteTCP, within the match rules of its routes and the domains of
+// its TLS certificate
+func traefikHandler(object []byte) ([]Field, error) {
+	obj, err := decodeUnstructured(object)
+	if err != nil {
+		return nil, err
+	}
+
+	routes, _, err := unstructured.NestedSlice(obj, "spec", "routes")
+	if err != nil {
+		return nil, fmt.Errorf("invalid spec.routes: %w", err)
+	}
+
+	var fields []Field
+	for i, route := range routes {
+		route, ok := route.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid spec.routes[%d]", i)
+		}
+
+		match, found, err := unstructured.NestedString(route, "match")
+		if err != nil {
+			return nil, fmt.Errorf("invalid spec.routes[%d].match: %w", i, err)
+		}
+		if !found {
+			continue
+		}
+
+		fields = append(fields, Field{
+			Path:    fmt.Sprintf("/spec/routes/%d/match", i),
+			Value:   match,
+			Rewrite: rewriteTraefikRule,
+		})
+	}
+
+	domains, _, err := unstructured.NestedSlice(obj, "spec", "tls", "domains")
+	if err != nil {
+		return nil, fmt.Errorf("invalid spec.tls.domains: %w", err)
+	}
+
+	for i, domain := range domains {
+		domain, ok := domain.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid spec.tls.domains[%d]", i)
+		}
+
+		main, found, err := unstructured.NestedString(domain, "main")
+		if err != nil {
+			return nil, fmt.Errorf("invalid spec.tls.domains[%d].main: %w", i, err)
+		}
+		if found {
+			fields = append(fields, Field{
+				Path:  fmt.Sprintf("/spec/tls/domains/%d/main", i),
+				Value: main,
+			})
+		}
+
+		sans, _, err := unstructured.NestedStringSlice(domain, "sans")
+		if err != nil {
+			return nil, fmt.Errorf("invalid spec.tls.domains[%d].sans: %w", i, err)
+		}
+		for j, san := range sans {
+			fields = append(fields, Field{
+				Path:  fmt.Sprintf("/spec/tls/domains/%d/sans/%d", i, j),
+				Value: san,
+			})
+		}
+	}
+
+	return fields, nil
+}
+
+// rewriteTraefikRule rewrites the arguments of the Host and HostSNI matchers
+// of a Traefik rule such as Host(`a.example.org`) && PathPrefix(`/a`). All
+// other matchers, including HostRegexp, are left unchanged. The rule is
+// returned as is from the first point it cannot be parsed.
+func rewriteTraefikRule(rule string, replace func(host string) string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(rule); {
+		c := rule[i]
+
+		switch {
+		case isTraefikQuote(c):
+			end := strings.IndexByte(rule[i+1:], c)
+			if end < 0 {
+				b.WriteString(rule[i:])
+				return b.String()
+			}
+			b.WriteString(rule[i : i+end+2])
+			i += end + 2
+		case isTraefikIdentifier(c):
+			start := i
+			for i < len(rule) && isTraefikIdentifier(rule[i]) {
+				i++
+			}
+			b.WriteString(rule[start:i])
+
+			if name := rule[start:i]; name != "Host" && name != "HostSNI" {
+				continue
+			}
+
+			args, n, ok := rewriteTraefikArgs(rule[i:], replace)
+			if !ok {
+				b.WriteString(rule[i:])
+				return b.String()
+			}
+			b.WriteString(args)
+			i += n
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	return b.String()
+}
+
+// rewriteTraefikArgs rewrites a parenthesised list of quoted hosts, returning
+// the rewritten list and the length of the original
+func rewriteTraefikArgs(s string, replace func(host string) string) (string, int, bool) {
+	var b strings.Builder
+
+	i := skipSpaces(s, 0)
+	if i >= len(s) || s[i] != '(' {
+		return "", 0, false
+	}
+	b.WriteString(s[:i+1])
+	i++
+
+	for {
+		next := skipSpaces(s, i)
+		b.WriteString(s[i:next])
+		i = next
+
+		if i >= len(s) || !isTraefikQuote(s[i]) {
+			return "", 0, false
+		}
+		quote := s[i]
+		end := strings.IndexByte(s[i+1:], quote)
+		if end < 0 {
+			return "", 0, false
+		}
+		b.WriteByte(quote)
+		b.WriteString(replace(s[i+1 : i+1+end]))
+		b.WriteByte(quote)
+		i += end + 2
+
+		next = skipSpaces(s, i)
+		b.WriteString(s[i:next])
+		i = next
+
+		if i >= len(s) {
+			return "", 0, false
+		}
+		switch s[i] {
+		case ',':
+			b.WriteByte(',')
+			i++
+		case ')':
+			b.WriteByte(')')
+			return b.String(), i + 1, true
+		default:
+			return "", 0, false
+		}
+	}
+}
+
+func isTraefikQuote(c byte) bool {
+	return c == '`' || c == '"'
+}
+
+func isTraefikIdentifier(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+func skipSpaces(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\n') {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,70 @@
+package mutator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteTraefikRule(t *testing.T) {
+	rules, err := ParseRules([]string{"example.org=example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replace := func(host string) string {
+		return replaceDomain(host, rules)
+	}
+
+	tc := []struct {
+		name string
+		rule string
+		want string
+	}{
+		{
+			name: "host",
+			rule: "Host(`a.example.org`)",
+			want: "Host(`a.example.com`)",
+		},
+		{
+			name: "host with path",
+			rule: "Host(`a.example.org`) && PathPrefix(`/a.example.org`)",
+			want: "Host(`a.example.com`) && PathPrefix(`/a.example.org`)",
+		},
+		{
+			name: "multiple hosts",
+			rule: "Host(`a.example.org`, \"b.example.org\") || Host( `c.example.net` )",
+			want: "Host(`a.example.com`, \"b.example.com\") || Host( `c.example.net` )",
+		},
+		{
+			name: "host sni",
+			rule: "HostSNI(`a.example.org`)",
+			want: "HostSNI(`a.example.com`)",
+		},
+		{
+			name: "host sni catch all",
+			rule: "HostSNI(`*`)",
+			want: "HostSNI(`*`)",
+		},
+		{
+			name: "other matchers",
+			rule: "HostRegexp(`{name:[a-z]+}.example.org`) || HostHeader(`a.example.org`) || Header(`Host`, `a.example.org`)",
+			want: "HostRegexp(`{name:[a-z]+}.example.org`) || HostHeader(`a.example.org`) || Header(`Host`, `a.example.org`)",
+		},
+		{
+			name: "host within quotes",
+			rule: "Path(`/Host(`) && Host(`a.example.org`)",
+			want: "Path(`/Host(`) && Host(`a.example.com`)",
+		},
+		{
+			name: "unterminated",
+			rule: "Host(`a.example.org`) && Host(`b.example.org",
+			want: "Host(`a.example.com`) && Host(`b.example.org",
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, rewriteTraefikRule(test.rule, replace))
+		})
+	}
+}
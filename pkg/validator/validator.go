@@ -0,0 +1,98 @@
+package validator
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	admission "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/mikelorant/muting/pkg/mutator"
+)
+
+// Config holds the domains used by Validate
+type Config struct {
+	// Domains are the allowed domains, hosts must be one of them or one of
+	// their subdomains
+	Domains []string
+
+	// Annotations are the keys of annotations holding hosts separated by
+	// commas or spaces
+	Annotations []string
+}
+
+// Validate receives an http request body (AdmissionReview), and the allowed
+// domains. It returns an AdmissionReview of the same version with an
+// AdmissionResponse denying the resource when any of its hosts, located as
+// Mutate locates them, is outside the allowed domains. As validating webhooks
+// are called after mutating webhooks, the hosts are those after mutation.
+func Validate(body []byte, config *Config) ([]byte, error) {
+	// unmarshal the request of either AdmissionReview version
+	review, err := mutator.DecodeReview(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return ValidateReview(review, config)
+}
+
+// ValidateReview is Validate for an AdmissionReview that has already been
+// decoded
+func ValidateReview(review *mutator.Review, config *Config) ([]byte, error) {
+	// prevent an empty allow-list denying every resource
+	if config == nil || len(config.Domains) == 0 {
+		return nil, fmt.Errorf("Received empty allowed domains")
+	}
+
+	hosts, err := mutator.Hosts(review, config.Annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	// set the response options
+	response := &admission.AdmissionResponse{}
+	response.Allowed = true
+	response.UID = review.Context.UID
+
+	// set the result as success
+	response.Result = &metav1.Status{
+		Status: metav1.StatusSuccess,
+	}
+
+	// deny the resource with the hosts outside the allowed domains
+	if denied := deniedHosts(hosts, config.Domains); len(denied) > 0 {
+		response.Allowed = false
+		response.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    http.StatusForbidden,
+			Reason:  metav1.StatusReasonForbidden,
+			Message: fmt.Sprintf("%s hosts %s are outside the allowed domains %s", review.Context.Kind.Kind, strings.Join(denied, ", "), strings.Join(config.Domains, ", ")),
+		}
+	}
+
+	return review.Respond(response)
+}
+
+// deniedHosts returns each distinct host that is not in one of the domains
+func deniedHosts(hosts []string, domains []string) []string {
+	seen := map[string]bool{}
+	var denied []string
+	for _, host := range hosts {
+		if seen[host] || allowed(host, domains) {
+			continue
+		}
+		seen[host] = true
+		denied = append(denied, host)
+	}
+	return denied
+}
+
+func allowed(host string, domains []string) bool {
+	for _, domain := range domains {
+		if mutator.InDomain(host, domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package validator
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/mikelorant/muting/pkg/mutator"
+)
+
+func getTestData(t *testing.T, file string) []byte {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestValidate(t *testing.T) {
+	tc := []struct {
+		name        string
+		testdata    string
+		domains     []string
+		annotations []string
+		allowed     bool
+		message     string
+		err         bool
+		errType     interface{}
+	}{
+		{
+			name:     "valid request allowed",
+			testdata: "valid-request-allowed.json",
+			domains:  []string{"test.two"},
+			allowed:  true,
+			err:      false,
+		},
+		{
+			name:     "valid request denied",
+			testdata: "valid-request-denied.json",
+			domains:  []string{"test.two", "test.three"},
+			allowed:  false,
+			message:  "Ingress hosts muting-b.test.one are outside the allowed domains test.two, test.three",
+			err:      false,
+		},
+		{
+			name:        "valid request denied annotation",
+			testdata:    "valid-request-denied.json",
+			domains:     []string{"test.two"},
+			annotations: []string{"external-dns.alpha.kubernetes.io/hostname"},
+			allowed:     false,
+			message:     "Ingress hosts muting-b.test.one, muting-c.test.one are outside the allowed domains test.two",
+			err:         false,
+		},
+		{
+			name:     "valid request v1beta1",
+			testdata: "valid-request-v1beta1.json",
+			domains:  []string{"test.two"},
+			allowed:  false,
+			message:  "Ingress hosts muting.test.one are outside the allowed domains test.two",
+			err:      false,
+		},
+		{
+			name:     "valid request unsupported kind",
+			testdata: "valid-request-unsupported-kind.json",
+			domains:  []string{"test.two"},
+			allowed:  true,
+			err:      false,
+		},
+		{
+			name:     "invalid request json",
+			testdata: "invalid-request-json.json",
+			domains:  []string{"test.two"},
+			err:      true,
+			errType:  &mutator.BadRequest{},
+		},
+		{
+			name:     "empty allowed domains",
+			testdata: "valid-request-allowed.json",
+			err:      true,
+			errType:  errors.New(""),
+		},
+	}
+
+	for _, test := range tc {
+		t.Run(test.name, func(t *testing.T) {
+			// execute the test
+			request := getTestData(t, test.testdata)
+			respBody, err := Validate(request, &Config{
+				Domains:     test.domains,
+				Annotations: test.annotations,
+			})
+
+			// validate error if error expected
+			if test.err {
+				assert.Error(t, err)
+				assert.IsType(t, test.errType, err)
+				return
+			}
+
+			// fail the test if we have an unexpected error
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+
+			// validate response
+			admReview := v1.AdmissionReview{}
+			err = json.Unmarshal(respBody, &admReview)
+			assert.NoError(t, err)
+			requestReview := metav1.TypeMeta{}
+			if err := json.Unmarshal(request, &requestReview); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, requestReview.APIVersion, admReview.APIVersion)
+			resp := admReview.Response
+			assert.Equal(t, test.allowed, resp.Allowed)
+			assert.Empty(t, resp.Patch)
+			if test.allowed {
+				assert.Equal(t, metav1.StatusSuccess, resp.Result.Status)
+				return
+			}
+			assert.Equal(t, metav1.StatusFailure, resp.Result.Status)
+			assert.Equal(t, int32(http.StatusForbidden), resp.Result.Code)
+			assert.Equal(t, metav1.StatusReasonForbidden, resp.Result.Reason)
+			assert.Equal(t, test.message, resp.Result.Message)
+		})
+	}
+}
+
+func TestDeniedHosts(t *testing.T) {
+	domains := []string{"example.com"}
+
+	// hosts that are not fully qualified are in no domain and denied too
+	assert.Equal(t, []string{"a.example.org", "*", "reviews", "reviews."}, deniedHosts([]string{
+		"a.example.com",
+		"*.example.com",
+		"a.example.org",
+		"a.example.org",
+		"*",
+		"reviews",
+		"reviews.",
+	}, domains))
+	assert.Empty(t, deniedHosts(nil, domains))
+}
@@ -0,0 +1,62 @@
+package watcher
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// Watch calls reload each time the file changes until stop is closed. The
+// directory of the file is watched rather than the file itself, so a file
+// replaced by swapping a symlink, as the files of a mounted ConfigMap are,
+// is still followed.
+func Watch(file string, reload func(), stop <-chan struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("Watch: unable to create watcher: %w", err)
+	}
+
+	file = filepath.Clean(file)
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("Watch: unable to watch %s: %w", file, err)
+	}
+
+	realFile, _ := filepath.EvalSymlinks(file)
+
+	go func() {
+		defer watcher.Close()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				// the file is written to or created, or a symlink on its path
+				// now leads to another file
+				currentFile, _ := filepath.EvalSymlinks(file)
+				written := filepath.Clean(event.Name) == file && event.Op&(fsnotify.Write|fsnotify.Create) != 0
+				swapped := currentFile != "" && currentFile != realFile
+				if !written && !swapped {
+					continue
+				}
+
+				realFile = currentFile
+				reload()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.WithError(err).Error("Failed to watch ", file)
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package watcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "mapping.yaml")
+	if err := ioutil.WriteFile(file, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reloads := make(chan struct{}, 10)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	if err := Watch(file, func() { reloads <- struct{}{} }, stop); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(file, []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assertReloaded(t, reloads)
+
+	// other files of the directory are ignored
+	if err := ioutil.WriteFile(filepath.Join(dir, "other.yaml"), []byte("c"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reloads:
+		t.Fatal("reloaded for another file")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWatchConfigMap(t *testing.T) {
+	// a mounted ConfigMap links its files through the ..data symlink, which
+	// is swapped to a new directory on each update
+	dir := t.TempDir()
+	for _, data := range []string{"..v1", "..v2"} {
+		if err := os.Mkdir(filepath.Join(dir, data), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, data, "mapping.yaml"), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("..v1", filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "mapping.yaml")
+	if err := os.Symlink(filepath.Join("..data", "mapping.yaml"), file); err != nil {
+		t.Fatal(err)
+	}
+
+	reloads := make(chan struct{}, 10)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	if err := Watch(file, func() { reloads <- struct{}{} }, stop); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink("..v2", filepath.Join(dir, "..data_tmp")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	assertReloaded(t, reloads)
+}
+
+func TestWatchMissingDirectory(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	err := Watch(filepath.Join(t.TempDir(), "missing", "mapping.yaml"), func() {}, stop)
+	assert.Error(t, err)
+}
+
+func assertReloaded(t *testing.T, reloads <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-reloads:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not reloaded")
+	}
+}